@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/bvankampen/metrics-viewer/internal/commands"
 	"github.com/bvankampen/metrics-viewer/internal/rxgo"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -48,7 +50,53 @@ func main() {
 			Value:  "~/.config/metrics-viewer.yaml",
 			EnvVar: "METRICS_VIEWER_CONFIG",
 		},
+		&cli.StringFlag{
+			Name:  "namespace, n",
+			Usage: "Namespace to discover annotated pods and services in, all namespaces if empty",
+		},
+		&cli.BoolFlag{
+			Name:  "events",
+			Usage: "Show a timeline of the Kubernetes events under the table",
+		},
+		&cli.StringFlag{
+			Name:  "events-namespace",
+			Usage: "Namespace to watch the events of with --events, all namespaces if empty",
+		},
+		&cli.StringSliceFlag{
+			Name:  "events-reason",
+			Usage: "Only show events with this reason, like BackOff, can be repeated",
+		},
+		&cli.BoolFlag{
+			Name:  "demo",
+			Usage: "View generated metrics of an apiserver instead of a cluster",
+		},
+		&cli.StringFlag{
+			Name:  "file, f",
+			Usage: "View a dump in the Prometheus text format, read again every scrape, or replay a directory of dumps instead of scraping the apiserver",
+		},
+		&cli.StringFlag{
+			Name:  "url",
+			Usage: "Scrape a Prometheus endpoint like http://host:9100/metrics instead of the apiserver, user:password@ in the url is used for basic auth",
+		},
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "Scrape an endpoint of the targets in the config file instead of the apiserver",
+		},
+		&cli.StringFlag{
+			Name:  "prometheus",
+			Usage: "Query a Prometheus server instead of scraping the apiserver: an url, a target in the config file or namespace/service:port through the apiserver",
+		},
+		&cli.StringSliceFlag{
+			Name:  "query",
+			Usage: "PromQL query to evaluate every scrape with --prometheus, can be repeated, the configured metrics are queried without it",
+		},
+		&cli.DurationFlag{
+			Name:  "range",
+			Usage: "History to load from the --prometheus server at start, 0 loads none",
+			Value: 15 * time.Minute,
+		},
 	}
+	app.Commands = commands.Commands()
 	app.Action = rxgo.Run
 	if err := app.Run(os.Args); err != nil {
 		logrus.Fatal(err)
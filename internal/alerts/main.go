@@ -0,0 +1,82 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/filter"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+func New(rules []config.Alert) (*Evaluator, error) {
+	e := &Evaluator{matches: make(map[string]int)}
+	return e, e.SetRules(rules)
+}
+
+// Replace the rules, a rule which is kept keeps counting. Rules with an invalid filter are skipped.
+func (e *Evaluator) SetRules(rules []config.Alert) error {
+	compiled := make([]rule, 0, len(rules))
+	var err error
+	for _, r := range rules {
+		var expression filter.Expression
+		if strings.TrimSpace(r.Filter) != "" { // the structured syntax only, like config validate
+			var parseErr error
+			if expression, parseErr = filter.Parse(r.Filter); parseErr != nil {
+				err = fmt.Errorf("alert %q: invalid filter: %v", r.Name, parseErr)
+				continue
+			}
+		}
+		compiled = append(compiled, rule{Alert: r, expression: expression})
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	matches := make(map[string]int, len(compiled))
+	for _, r := range compiled {
+		if previous, ok := e.rule(r.Name); ok && previous.Metric == r.Metric && previous.Filter == r.Filter {
+			matches[r.Name] = e.matches[r.Name]
+		}
+	}
+	e.rules, e.matches = compiled, matches
+	return err
+}
+
+func (e *Evaluator) rule(name string) (rule, bool) {
+	for _, r := range e.rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+// Count the matching series of a scrape, returns the firing alerts in the order of the rules
+func (e *Evaluator) Evaluate(data realtimedata.RealTimeData) []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	firing := []Alert{}
+	for _, r := range e.rules {
+		series := 0
+		for i := range data.Metrics {
+			metric := &data.Metrics[i]
+			if metric.Name != r.Metric {
+				continue
+			}
+			for j := range metric.Values {
+				if metric.Values[j].LastSeen == data.Generation && filter.Match(r.expression, metric, &metric.Values[j]) {
+					series++
+				}
+			}
+		}
+		if series == 0 {
+			e.matches[r.Name] = 0
+			continue
+		}
+		e.matches[r.Name]++
+		if e.matches[r.Name] >= max(r.For, 1) {
+			firing = append(firing, Alert{Name: r.Name, Series: series, Since: e.matches[r.Name]})
+		}
+	}
+	return firing
+}
@@ -0,0 +1,86 @@
+package alerts
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// A scrape of the queued requests by priority level
+func scrape(generation int, values ...string) realtimedata.RealTimeData {
+	levels := []string{"workload-low", "global-default", "catch-all"}
+	metric := realtimedata.RealTimeDataMetric{Name: "apiserver_flowcontrol_current_inqueue_requests", Type: "gauge"}
+	for i, value := range values {
+		metric.Values = append(metric.Values, realtimedata.RealTimeDataMetricValue{
+			Labels:   []realtimedata.RealTimeDataMetricLabel{{Label: "priority_level", Value: levels[i]}},
+			Value:    value,
+			LastSeen: generation,
+		})
+	}
+	return realtimedata.RealTimeData{Metrics: []realtimedata.RealTimeDataMetric{metric}, Generation: generation}
+}
+
+var queued = config.Alert{Name: "queued", Metric: "apiserver_flowcontrol_current_inqueue_requests", Filter: "value>10", For: 2}
+
+func TestEvaluate(t *testing.T) {
+	e, err := New([]config.Alert{queued, {Name: "any", Metric: "apiserver_flowcontrol_current_inqueue_requests"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		data     realtimedata.RealTimeData
+		expected []Alert
+	}{
+		{scrape(1, "20", "0"), []Alert{{Name: "any", Series: 2, Since: 1}}},
+		{scrape(2, "20", "30", "1"), []Alert{{Name: "queued", Series: 2, Since: 2}, {Name: "any", Series: 3, Since: 2}}},
+		{scrape(3, "0", "0"), []Alert{{Name: "any", Series: 2, Since: 3}}},
+		{scrape(4, "20"), []Alert{{Name: "any", Series: 1, Since: 4}}},
+		{scrape(5), []Alert{}},
+	} {
+		if firing := e.Evaluate(test.data); !reflect.DeepEqual(firing, test.expected) {
+			t.Errorf("scrape %d: expected %+v, got %+v", i+1, test.expected, firing)
+		}
+	}
+
+	stale := scrape(7, "20")
+	stale.Metrics[0].Values[0].LastSeen = 6
+	if firing := e.Evaluate(stale); len(firing) != 0 {
+		t.Errorf("expected stale series not to match, got %+v", firing)
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	e, err := New([]config.Alert{queued})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Evaluate(scrape(1, "20"))
+
+	if err := e.SetRules([]config.Alert{queued, {Name: "new", Metric: queued.Metric}}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Alert{{Name: "queued", Series: 1, Since: 2}, {Name: "new", Series: 1, Since: 1}}
+	if firing := e.Evaluate(scrape(2, "20")); !reflect.DeepEqual(firing, expected) {
+		t.Errorf("expected the kept rule to keep counting %+v, got %+v", expected, firing)
+	}
+
+	changed := queued
+	changed.Filter = "value>15"
+	if err := e.SetRules([]config.Alert{changed}); err != nil {
+		t.Fatal(err)
+	}
+	if firing := e.Evaluate(scrape(3, "20")); len(firing) != 0 {
+		t.Errorf("expected a changed rule to count again, got %+v", firing)
+	}
+
+	err = e.SetRules([]config.Alert{{Name: "broken", Metric: queued.Metric, Filter: "value>"}, {Name: "any", Metric: queued.Metric}})
+	if err == nil {
+		t.Fatal("expected an error for the invalid filter")
+	}
+	expected = []Alert{{Name: "any", Series: 1, Since: 1}}
+	if firing := e.Evaluate(scrape(4, "20")); !reflect.DeepEqual(firing, expected) {
+		t.Errorf("expected the invalid rule to be skipped %+v, got %+v", expected, firing)
+	}
+}
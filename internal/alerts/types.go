@@ -0,0 +1,27 @@
+package alerts
+
+import (
+	"sync"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/filter"
+)
+
+// Evaluates the alert rules on every scrape, the rules can be replaced while scraping
+type Evaluator struct {
+	mutex   sync.Mutex
+	rules   []rule
+	matches map[string]int // scrapes in a row with matching series by rule name
+}
+
+type rule struct {
+	config.Alert
+	expression filter.Expression // nil matches every series
+}
+
+// Rule with matching series for at least the scrapes of its for
+type Alert struct {
+	Name   string
+	Series int // matching series in the last scrape
+	Since  int // scrapes in a row with matching series
+}
@@ -0,0 +1,262 @@
+package apf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	flowcontrolv1 "k8s.io/api/flowcontrol/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	nominalSeats   = "apiserver_flowcontrol_nominal_limit_seats"
+	lowerSeats     = "apiserver_flowcontrol_lower_limit_seats"
+	upperSeats     = "apiserver_flowcontrol_upper_limit_seats"
+	currentSeats   = "apiserver_flowcontrol_current_limit_seats"
+	inQueue        = "apiserver_flowcontrol_current_inqueue_requests"
+	executing      = "apiserver_flowcontrol_current_executing_requests"
+	executingSeats = "apiserver_flowcontrol_current_executing_seats"
+	rejected       = "apiserver_flowcontrol_rejected_requests_total"
+	waitDuration   = "apiserver_flowcontrol_request_wait_duration_seconds"
+)
+
+// Metrics needed for the dashboard
+var Metrics = []string{nominalSeats, lowerSeats, upperSeats, currentSeats, inQueue, executing, executingSeats, rejected, waitDuration}
+
+// Join the flowcontrol metrics per priority level, ordered by name
+func Summarize(data realtimedata.RealTimeData, configuration *Configuration) []PriorityLevel {
+	levels := make(map[string]*PriorityLevel)
+	level := func(name string) *PriorityLevel {
+		if l, ok := levels[name]; ok {
+			return l
+		}
+		l := &PriorityLevel{Name: name, RejectedRate: math.NaN(), WaitP50: math.NaN(), WaitP90: math.NaN(), WaitP99: math.NaN()}
+		levels[name] = l
+		return l
+	}
+	if configuration != nil {
+		for i := range configuration.PriorityLevels {
+			level(configuration.PriorityLevels[i].Name).Config = &configuration.PriorityLevels[i]
+		}
+	}
+
+	elapsed := data.Time.Sub(data.PreviousTime).Seconds()
+	waits := make(map[string][]realtimedata.RealTimeDataBucket)
+	for _, metric := range data.Metrics {
+		for _, value := range metric.Values {
+			name := labelValue(value, "priority_level")
+			if name == "" || value.LastSeen != data.Generation {
+				continue
+			}
+			l := level(name)
+			v, _ := strconv.ParseFloat(value.Value, 64)
+			switch metric.Name {
+			case nominalSeats:
+				l.NominalSeats = v
+			case lowerSeats:
+				l.LowerSeats = v
+			case upperSeats:
+				l.UpperSeats = v
+			case currentSeats:
+				l.CurrentSeats = v
+			case inQueue:
+				l.InQueue += v
+			case executing:
+				l.Executing += v
+			case executingSeats:
+				l.ExecutingSeats += v
+			case rejected:
+				previous, err := strconv.ParseFloat(value.PreviousValue, 64)
+				if err != nil || data.PreviousTime.IsZero() || elapsed <= 0 || v < previous {
+					continue
+				}
+				if math.IsNaN(l.RejectedRate) {
+					l.RejectedRate = 0
+				}
+				l.RejectedRate += (v - previous) / elapsed
+			case waitDuration:
+				if len(value.PreviousBuckets) > 0 {
+					waits[name] = realtimedata.SumBuckets(waits[name], realtimedata.DeltaBuckets(value.Buckets, value.PreviousBuckets))
+				}
+			}
+		}
+	}
+	for name, buckets := range waits {
+		l := levels[name]
+		l.WaitP50 = realtimedata.Quantile(0.5, buckets)
+		l.WaitP90 = realtimedata.Quantile(0.9, buckets)
+		l.WaitP99 = realtimedata.Quantile(0.99, buckets)
+	}
+
+	summary := make([]PriorityLevel, 0, len(levels))
+	for _, l := range levels {
+		summary = append(summary, *l)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Name < summary[j].Name })
+	return summary
+}
+
+func labelValue(value realtimedata.RealTimeDataMetricValue, label string) string {
+	for _, l := range value.Labels {
+		if l.Label == label {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+func NewClient(restConfig *rest.Config) (*Client, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{clientset: clientset}, nil
+}
+
+// Fetch the PriorityLevelConfiguration and FlowSchema objects, clusters before 1.29 without
+// flowcontrol/v1 are read with v1beta3
+func (c *Client) Fetch(ctx context.Context) (Configuration, error) {
+	configuration := Configuration{}
+
+	priorityLevels, flowSchemas, err := c.listV1(ctx)
+	if apierrors.IsNotFound(err) {
+		priorityLevels, flowSchemas, err = c.listV1beta3(ctx)
+	}
+	if err != nil {
+		return configuration, err
+	}
+	for _, pl := range priorityLevels.Items {
+		configuration.PriorityLevels = append(configuration.PriorityLevels, convertPriorityLevel(pl))
+	}
+	for _, fs := range flowSchemas.Items {
+		configuration.FlowSchemas = append(configuration.FlowSchemas, convertFlowSchema(fs))
+	}
+	sort.SliceStable(configuration.FlowSchemas, func(i, j int) bool {
+		return configuration.FlowSchemas[i].MatchingPrecedence < configuration.FlowSchemas[j].MatchingPrecedence
+	})
+	return configuration, nil
+}
+
+func (c *Client) listV1(ctx context.Context) (*flowcontrolv1.PriorityLevelConfigurationList, *flowcontrolv1.FlowSchemaList, error) {
+	priorityLevels, err := c.clientset.FlowcontrolV1().PriorityLevelConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list priority level configurations: %w", err)
+	}
+	flowSchemas, err := c.clientset.FlowcontrolV1().FlowSchemas().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list flow schemas: %w", err)
+	}
+	return priorityLevels, flowSchemas, nil
+}
+
+// List with v1beta3 and convert to v1, the fields of the versions have the same JSON names
+func (c *Client) listV1beta3(ctx context.Context) (*flowcontrolv1.PriorityLevelConfigurationList, *flowcontrolv1.FlowSchemaList, error) {
+	betaPriorityLevels, err := c.clientset.FlowcontrolV1beta3().PriorityLevelConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list priority level configurations with flowcontrol/v1 or v1beta3: %w", err)
+	}
+	betaFlowSchemas, err := c.clientset.FlowcontrolV1beta3().FlowSchemas().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list flow schemas with flowcontrol/v1 or v1beta3: %w", err)
+	}
+	priorityLevels := &flowcontrolv1.PriorityLevelConfigurationList{}
+	if err := convertVersion(betaPriorityLevels, priorityLevels); err != nil {
+		return nil, nil, err
+	}
+	flowSchemas := &flowcontrolv1.FlowSchemaList{}
+	if err := convertVersion(betaFlowSchemas, flowSchemas); err != nil {
+		return nil, nil, err
+	}
+	return priorityLevels, flowSchemas, nil
+}
+
+func convertVersion(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func convertPriorityLevel(pl flowcontrolv1.PriorityLevelConfiguration) PriorityLevelConfig {
+	config := PriorityLevelConfig{
+		Name: pl.Name,
+		Type: string(pl.Spec.Type),
+	}
+	switch {
+	case pl.Spec.Limited != nil:
+		limited := pl.Spec.Limited
+		config.NominalConcurrencyShares = valueOf(limited.NominalConcurrencyShares)
+		config.LendablePercent = valueOf(limited.LendablePercent)
+		config.BorrowingLimitPercent = limited.BorrowingLimitPercent
+		config.Queuing = "reject"
+		if q := limited.LimitResponse.Queuing; limited.LimitResponse.Type == flowcontrolv1.LimitResponseTypeQueue && q != nil {
+			config.Queuing = fmt.Sprintf("%d queues, hand %d, length %d", q.Queues, q.HandSize, q.QueueLengthLimit)
+		}
+	case pl.Spec.Exempt != nil:
+		config.NominalConcurrencyShares = valueOf(pl.Spec.Exempt.NominalConcurrencyShares)
+		config.LendablePercent = valueOf(pl.Spec.Exempt.LendablePercent)
+	}
+	return config
+}
+
+func convertFlowSchema(fs flowcontrolv1.FlowSchema) FlowSchema {
+	schema := FlowSchema{
+		Name:               fs.Name,
+		PriorityLevel:      fs.Spec.PriorityLevelConfiguration.Name,
+		MatchingPrecedence: fs.Spec.MatchingPrecedence,
+	}
+	if fs.Spec.DistinguisherMethod != nil {
+		schema.Distinguisher = string(fs.Spec.DistinguisherMethod.Type)
+	}
+	for _, rule := range fs.Spec.Rules {
+		schema.Rules = append(schema.Rules, ruleToString(rule))
+	}
+	return schema
+}
+
+// Short description like: group:system:nodes -> get,list nodes,pods in *
+func ruleToString(rule flowcontrolv1.PolicyRulesWithSubjects) string {
+	subjects := []string{}
+	for _, s := range rule.Subjects {
+		switch {
+		case s.User != nil:
+			subjects = append(subjects, "user:"+s.User.Name)
+		case s.Group != nil:
+			subjects = append(subjects, "group:"+s.Group.Name)
+		case s.ServiceAccount != nil:
+			subjects = append(subjects, "sa:"+s.ServiceAccount.Namespace+"/"+s.ServiceAccount.Name)
+		}
+	}
+	matches := []string{}
+	for _, r := range rule.ResourceRules {
+		match := fmt.Sprintf("%s %s", strings.Join(r.Verbs, ","), strings.Join(r.Resources, ","))
+		if len(r.Namespaces) > 0 {
+			match += " in " + strings.Join(r.Namespaces, ",")
+		}
+		if r.ClusterScope {
+			match += " (cluster)"
+		}
+		matches = append(matches, match)
+	}
+	for _, r := range rule.NonResourceRules {
+		matches = append(matches, fmt.Sprintf("%s %s", strings.Join(r.Verbs, ","), strings.Join(r.NonResourceURLs, ",")))
+	}
+	return strings.Join(subjects, ",") + " -> " + strings.Join(matches, "; ")
+}
+
+func valueOf(i *int32) int32 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
@@ -0,0 +1,116 @@
+package apf
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// Page of the flowcontrol metrics with the rejected count and the cumulative wait buckets of workload-low
+func page(rejected int, waits ...int) string {
+	var b strings.Builder
+	b.WriteString("# TYPE apiserver_flowcontrol_current_limit_seats gauge\n")
+	b.WriteString("apiserver_flowcontrol_current_limit_seats{priority_level=\"workload-low\"} 245\n")
+	b.WriteString("# TYPE apiserver_flowcontrol_current_inqueue_requests gauge\n")
+	b.WriteString("apiserver_flowcontrol_current_inqueue_requests{flow_schema=\"service-accounts\",priority_level=\"workload-low\"} 3\n")
+	b.WriteString("apiserver_flowcontrol_current_inqueue_requests{flow_schema=\"kube-controller-manager\",priority_level=\"workload-low\"} 2\n")
+	b.WriteString("# TYPE apiserver_flowcontrol_rejected_requests_total counter\n")
+	fmt.Fprintf(&b, "apiserver_flowcontrol_rejected_requests_total{priority_level=\"workload-low\",reason=\"queue-full\"} %d\n", rejected)
+	b.WriteString("# TYPE apiserver_flowcontrol_request_wait_duration_seconds histogram\n")
+	for i, le := range []string{"0.1", "0.5", "1", "+Inf"} {
+		fmt.Fprintf(&b, "apiserver_flowcontrol_request_wait_duration_seconds_bucket{execute=\"true\",priority_level=\"workload-low\",le=%q} %d\n", le, waits[i])
+	}
+	fmt.Fprintf(&b, "apiserver_flowcontrol_request_wait_duration_seconds_count{execute=\"true\",priority_level=\"workload-low\"} %d\n", waits[3])
+	return b.String()
+}
+
+func TestSummarize(t *testing.T) {
+	d := realtimedata.RealTimeData{}
+	scrape := func(page string) []PriorityLevel {
+		previous := d.Time
+		d.NextGeneration()
+		if err := d.Parse(strings.NewReader(page), nil); err != nil {
+			t.Fatal(err)
+		}
+		d.Time = previous.Add(10 * time.Second)
+		return Summarize(d.Snapshot(), nil)
+	}
+
+	first := scrape(page(10, 10, 60, 90, 100))
+	if len(first) != 1 || first[0].CurrentSeats != 245 || first[0].InQueue != 5 {
+		t.Fatalf("unexpected priority levels %+v", first)
+	}
+	if !math.IsNaN(first[0].RejectedRate) || !math.IsNaN(first[0].WaitP50) {
+		t.Errorf("expected no rates after the first scrape, got %+v", first[0])
+	}
+
+	second := scrape(page(30, 15, 70, 100, 115))[0]
+	if second.RejectedRate != 2 {
+		t.Errorf("expected 2 rejections per second, got %v", second.RejectedRate)
+	}
+	if math.Abs(second.WaitP50-0.3) > 1e-9 || second.WaitP99 != 1 {
+		t.Errorf("expected the quantiles of the new observations, got %v %v", second.WaitP50, second.WaitP99)
+	}
+
+	// the apiserver restarted between the scrapes
+	reset := scrape(page(5, 2, 2, 3, 4))[0]
+	if !math.IsNaN(reset.RejectedRate) {
+		t.Errorf("expected no rate after a reset, got %v", reset.RejectedRate)
+	}
+	if math.Abs(reset.WaitP50-0.1) > 1e-9 || reset.WaitP90 < 0 {
+		t.Errorf("expected the quantiles since the restart, got %v %v", reset.WaitP50, reset.WaitP90)
+	}
+}
+
+func TestFetchV1beta3(t *testing.T) {
+	shares := int32(30)
+	clientset := fake.NewSimpleClientset(
+		&flowcontrolv1beta3.PriorityLevelConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "workload-low"},
+			Spec: flowcontrolv1beta3.PriorityLevelConfigurationSpec{
+				Type: flowcontrolv1beta3.PriorityLevelEnablementLimited,
+				Limited: &flowcontrolv1beta3.LimitedPriorityLevelConfiguration{
+					NominalConcurrencyShares: shares,
+					LimitResponse:            flowcontrolv1beta3.LimitResponse{Type: flowcontrolv1beta3.LimitResponseTypeReject},
+				},
+			},
+		},
+		&flowcontrolv1beta3.FlowSchema{
+			ObjectMeta: metav1.ObjectMeta{Name: "service-accounts"},
+			Spec: flowcontrolv1beta3.FlowSchemaSpec{
+				PriorityLevelConfiguration: flowcontrolv1beta3.PriorityLevelConfigurationReference{Name: "workload-low"},
+				MatchingPrecedence:         9000,
+			},
+		},
+	)
+	// a cluster before 1.29 doesn't serve flowcontrol/v1
+	clientset.PrependReactor("list", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetResource().Version == "v1" {
+			return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "flowcontrol.apiserver.k8s.io", Resource: action.GetResource().Resource}, "")
+		}
+		return false, nil, nil
+	})
+
+	configuration, err := (&Client{clientset: clientset}).Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configuration.PriorityLevels) != 1 || configuration.PriorityLevels[0].NominalConcurrencyShares != shares || configuration.PriorityLevels[0].Queuing != "reject" {
+		t.Errorf("unexpected priority levels %+v", configuration.PriorityLevels)
+	}
+	if len(configuration.FlowSchemas) != 1 || configuration.FlowSchemas[0].PriorityLevel != "workload-low" {
+		t.Errorf("unexpected flow schemas %+v", configuration.FlowSchemas)
+	}
+}
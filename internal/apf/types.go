@@ -0,0 +1,51 @@
+package apf
+
+import (
+	"k8s.io/client-go/kubernetes"
+)
+
+// Live numbers of a priority level joined from the apiserver_flowcontrol_* metrics
+type PriorityLevel struct {
+	Name           string
+	NominalSeats   float64
+	LowerSeats     float64
+	UpperSeats     float64
+	CurrentSeats   float64
+	InQueue        float64 // requests
+	Executing      float64 // requests
+	ExecutingSeats float64
+	RejectedRate   float64 // requests per second, NaN if unknown
+	WaitP50        float64 // seconds, NaN if no request waited since the previous scrape
+	WaitP90        float64
+	WaitP99        float64
+	Config         *PriorityLevelConfig // nil if the configuration isn't fetched
+}
+
+// Configured shares and queuing of a PriorityLevelConfiguration
+type PriorityLevelConfig struct {
+	Name                     string
+	Type                     string // Exempt or Limited
+	NominalConcurrencyShares int32
+	LendablePercent          int32
+	BorrowingLimitPercent    *int32 // nil means no limit
+	Queuing                  string
+}
+
+// Matching rules of a FlowSchema
+type FlowSchema struct {
+	Name               string
+	PriorityLevel      string
+	MatchingPrecedence int32
+	Distinguisher      string
+	Rules              []string
+}
+
+type Configuration struct {
+	PriorityLevels []PriorityLevelConfig
+	FlowSchemas    []FlowSchema // ordered by matching precedence
+}
+
+// Client for the flowcontrol.apiserver.k8s.io objects
+type Client struct {
+	clientset kubernetes.Interface
+}
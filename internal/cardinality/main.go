@@ -0,0 +1,107 @@
+package cardinality
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// Count the series of the last scrape per family and the distinct values per label key
+func Analyze(data realtimedata.RealTimeData) Report {
+	report := Report{Bytes: data.Bytes}
+	labelValues := make(map[string]map[string]struct{})
+	labelFamilies := make(map[string]int)
+
+	for _, metric := range data.Metrics {
+		family := Family{Name: metric.Name, Type: metric.Type, Bytes: metric.Bytes}
+		familyLabels := make(map[string]struct{})
+		addLabel := func(label, value string) {
+			if _, ok := labelValues[label]; !ok {
+				labelValues[label] = make(map[string]struct{})
+			}
+			labelValues[label][value] = struct{}{}
+			familyLabels[label] = struct{}{}
+		}
+		for _, value := range metric.Values {
+			if value.LastSeen != data.Generation {
+				continue
+			}
+			family.Series += series(value)
+			for _, label := range value.Labels {
+				addLabel(label.Label, label.Value)
+			}
+			for _, bucket := range value.Buckets {
+				addLabel("le", strconv.FormatFloat(bucket.UpperBound, 'g', -1, 64))
+			}
+		}
+		if family.Series == 0 {
+			continue
+		}
+		if data.Bytes > 0 {
+			family.Share = float64(family.Bytes) / float64(data.Bytes)
+		}
+		for label := range familyLabels {
+			family.Labels = append(family.Labels, label)
+			labelFamilies[label]++
+		}
+		sort.Strings(family.Labels)
+		report.Series += family.Series
+		report.Families = append(report.Families, family)
+	}
+
+	for label, values := range labelValues {
+		report.Labels = append(report.Labels, Label{Name: label, Values: len(values), Families: labelFamilies[label]})
+	}
+	sort.Slice(report.Families, func(i, j int) bool {
+		if report.Families[i].Series != report.Families[j].Series {
+			return report.Families[i].Series > report.Families[j].Series
+		}
+		return report.Families[i].Name < report.Families[j].Name
+	})
+	sort.Slice(report.Labels, func(i, j int) bool {
+		if report.Labels[i].Values != report.Labels[j].Values {
+			return report.Labels[i].Values > report.Labels[j].Values
+		}
+		return report.Labels[i].Name < report.Labels[j].Name
+	})
+	return report
+}
+
+// Number of series in the page, a histogram has a series per bucket next to _sum and _count
+func series(value realtimedata.RealTimeDataMetricValue) int {
+	n := 1 + len(value.Buckets)
+	if value.Count != "" {
+		n++
+	}
+	return n
+}
+
+// Set the changes since an earlier report, families and labels which are new count from zero
+func (r *Report) Compare(previous Report) {
+	families := make(map[string]Family, len(previous.Families))
+	for _, f := range previous.Families {
+		families[f.Name] = f
+	}
+	for i := range r.Families {
+		f := &r.Families[i]
+		f.SeriesChange = f.Series - families[f.Name].Series
+		f.BytesChange = f.Bytes - families[f.Name].Bytes
+	}
+	labels := make(map[string]int, len(previous.Labels))
+	for _, l := range previous.Labels {
+		labels[l.Name] = l.Values
+	}
+	for i := range r.Labels {
+		r.Labels[i].ValuesChange = r.Labels[i].Values - labels[r.Labels[i].Name]
+	}
+}
+
+// Keep the first n families and labels, n <= 0 keeps all
+func (r *Report) Top(n int) {
+	if n <= 0 {
+		return
+	}
+	r.Families = r.Families[:min(n, len(r.Families))]
+	r.Labels = r.Labels[:min(n, len(r.Labels))]
+}
@@ -0,0 +1,86 @@
+package cardinality
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+const samplePage = `# TYPE apiserver_request_total counter
+apiserver_request_total{verb="GET",code="200"} 10
+apiserver_request_total{verb="LIST",code="200"} 5
+apiserver_request_total{verb="GET",code="404"} 1
+# TYPE apiserver_request_duration_seconds histogram
+apiserver_request_duration_seconds_bucket{verb="GET",le="0.1"} 8
+apiserver_request_duration_seconds_bucket{verb="GET",le="1"} 10
+apiserver_request_duration_seconds_bucket{verb="GET",le="+Inf"} 10
+apiserver_request_duration_seconds_sum{verb="GET"} 2
+apiserver_request_duration_seconds_count{verb="GET"} 10
+# TYPE up gauge
+up 1
+`
+
+func parse(t *testing.T, data *realtimedata.RealTimeData, page string) {
+	data.NextGeneration()
+	if err := data.Parse(strings.NewReader(page), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	data := realtimedata.RealTimeData{}
+	parse(t, &data, samplePage)
+	report := Analyze(data)
+
+	families := []string{}
+	for _, f := range report.Families {
+		families = append(families, fmt.Sprintf("%s:%d:%s", f.Name, f.Series, strings.Join(f.Labels, ",")))
+	}
+	// a histogram counts its buckets, _sum and _count, ties are ordered by name
+	expected := "apiserver_request_duration_seconds:5:le,verb apiserver_request_total:3:code,verb up:1:"
+	if got := strings.Join(families, " "); got != expected {
+		t.Errorf("expected the families by series %s, got %s", expected, got)
+	}
+	if report.Series != 9 || report.Bytes != len(samplePage) {
+		t.Errorf("expected 9 series in %d bytes, got %d in %d", len(samplePage), report.Series, report.Bytes)
+	}
+
+	labels := []string{}
+	for _, l := range report.Labels {
+		labels = append(labels, fmt.Sprintf("%s:%d:%d", l.Name, l.Values, l.Families))
+	}
+	if got := strings.Join(labels, " "); got != "le:3:1 code:2:1 verb:2:2" {
+		t.Errorf("unexpected labels by distinct values %s", got)
+	}
+
+	report.Top(2)
+	if len(report.Families) != 2 || report.Families[1].Name != "apiserver_request_total" || len(report.Labels) != 2 {
+		t.Errorf("expected the top 2 families and labels, got %+v", report)
+	}
+	report.Top(0)
+	if len(report.Families) != 2 {
+		t.Errorf("expected top 0 to keep all, got %d families", len(report.Families))
+	}
+}
+
+func TestCompare(t *testing.T) {
+	data := realtimedata.RealTimeData{}
+	parse(t, &data, samplePage)
+	first := Analyze(data)
+	// the GET 404 series is gone and a new code comes
+	parse(t, &data, strings.Replace(samplePage, `verb="GET",code="404"} 1`, `verb="GET",code="500"} 1`+"\n"+`apiserver_request_total{verb="GET",code="503"} 1`, 1))
+	report := Analyze(data)
+	report.Compare(first)
+	for _, f := range report.Families {
+		if f.Name == "apiserver_request_total" && (f.Series != 4 || f.SeriesChange != 1) {
+			t.Errorf("expected 4 series and 1 more, got %+v", f)
+		}
+	}
+	for _, l := range report.Labels {
+		if l.Name == "code" && (l.Values != 3 || l.ValuesChange != 1) {
+			t.Errorf("expected 3 codes and 1 more, got %+v", l)
+		}
+	}
+}
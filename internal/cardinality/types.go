@@ -0,0 +1,27 @@
+package cardinality
+
+// Series and label counts of a scraped page
+type Report struct {
+	Bytes    int      `json:"bytes"`
+	Series   int      `json:"series"`
+	Families []Family `json:"families"` // most series first
+	Labels   []Label  `json:"labels"`   // most distinct values first
+}
+
+type Family struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Series       int      `json:"series"`
+	SeriesChange int      `json:"seriesChange"` // since the compared report
+	Bytes        int      `json:"bytes"`
+	BytesChange  int      `json:"bytesChange"`
+	Share        float64  `json:"share"` // part of the bytes of the page
+	Labels       []string `json:"labels"`
+}
+
+type Label struct {
+	Name         string `json:"name"`
+	Values       int    `json:"values"` // distinct values over all families
+	ValuesChange int    `json:"valuesChange"`
+	Families     int    `json:"families"` // number of families with this label
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/cardinality"
+	"github.com/urfave/cli"
+)
+
+func cardinalityCommand() cli.Command {
+	return cli.Command{
+		Name:  "cardinality",
+		Usage: "Rank the metric families by series and the labels by distinct values",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "top",
+				Usage: "Number of families and labels to show, 0 shows all",
+				Value: 20,
+			},
+			&cli.IntFlag{
+				Name:  "scrapes",
+				Usage: "Number of scrapes, the changes are shown since the first scrape",
+				Value: 1,
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "Time between the scrapes",
+				Value: 10 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format: text or json",
+				Value: "text",
+			},
+		},
+		Action: cardinalityReport,
+	}
+}
+
+func cardinalityReport(ctx *cli.Context) error {
+	output := ctx.String("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output %q, use text or json", output)
+	}
+	s, err := newSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	var first, report cardinality.Report
+	for i := 0; i < max(ctx.Int("scrapes"), 1); i++ {
+		if i > 0 {
+			time.Sleep(ctx.Duration("interval"))
+		}
+		data, err := s.Scrape()
+		if err != nil {
+			return err
+		}
+		report = cardinality.Analyze(data)
+		if i == 0 {
+			first = report
+		}
+		report.Compare(first)
+		fmt.Fprintf(os.Stderr, "scrape %d: %d series (%s), %s (%s)\n", i+1,
+			report.Series, formatChange(report.Series-first.Series),
+			formatBytes(report.Bytes), formatChange(report.Bytes-first.Bytes))
+	}
+
+	report.Top(ctx.Int("top"))
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tTYPE\tSERIES\tCHANGE\tBYTES\tSHARE\tLABELS")
+	for _, f := range report.Families {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\t%.1f%%\t%s\n", f.Name, f.Type, f.Series, formatChange(f.SeriesChange),
+			formatBytes(f.Bytes), f.Share*100, strings.Join(f.Labels, ","))
+	}
+	writer.Flush()
+	fmt.Println()
+	writer = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "LABEL\tVALUES\tCHANGE\tFAMILIES")
+	for _, l := range report.Labels {
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%d\n", l.Name, l.Values, formatChange(l.ValuesChange), l.Families)
+	}
+	return writer.Flush()
+}
+
+func formatChange(change int) string {
+	if change > 0 {
+		return fmt.Sprintf("+%d", change)
+	}
+	return fmt.Sprintf("%d", change)
+}
+
+func formatBytes(bytes int) string {
+	switch {
+	case bytes >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(bytes)/1024/1024)
+	case bytes >= 1024:
+		return fmt.Sprintf("%.1fKB", float64(bytes)/1024)
+	}
+	return fmt.Sprintf("%dB", bytes)
+}
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli"
+)
+
+func configCommand() cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "Manage the configuration file",
+		Subcommands: []cli.Command{
+			{
+				Name:  "init",
+				Usage: "Write the default configuration file",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Overwrite an existing configuration file",
+					},
+				},
+				Action: configInit,
+			},
+			{
+				Name:   "validate",
+				Usage:  "Validate the configuration file",
+				Action: configValidate,
+			},
+			{
+				Name:   "show",
+				Usage:  "Show the effective configuration including defaults",
+				Action: configShow,
+			},
+			{
+				Name:   "path",
+				Usage:  "Show which configuration file is used",
+				Action: configPath,
+			},
+		},
+	}
+}
+
+func configFilename(ctx *cli.Context) string {
+	filename, _ := homedir.Expand(ctx.GlobalString("config"))
+	return filename
+}
+
+func configInit(ctx *cli.Context) error {
+	filename := configFilename(ctx)
+	if err := config.WriteDefault(filename, ctx.Bool("force")); err != nil {
+		return err
+	}
+	fmt.Printf("Configuration written to %s\n", filename)
+	return nil
+}
+
+func configValidate(ctx *cli.Context) error {
+	filename := configFilename(ctx)
+	yamlConfig, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	errs := config.Validate(yamlConfig)
+	for _, err := range errs {
+		fmt.Printf("%s: %v\n", filename, err)
+	}
+	if len(errs) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d problem(s) found", len(errs)), 1)
+	}
+	fmt.Printf("%s is valid\n", filename)
+	return nil
+}
+
+func configShow(ctx *cli.Context) error {
+	applicationConfig, err := config.Load(configFilename(ctx))
+	if err != nil {
+		return err
+	}
+	fmt.Println(applicationConfig)
+	return nil
+}
+
+func configPath(ctx *cli.Context) error {
+	filename := configFilename(ctx)
+	source := "default"
+	if ctx.GlobalIsSet("config") {
+		source = "--config or METRICS_VIEWER_CONFIG"
+	}
+	state := "exists"
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		state = "does not exist, it will be created on start"
+	}
+	fmt.Printf("%s (%s, %s)\n", filename, source, state)
+	return nil
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/bvankampen/metrics-viewer/internal/diff"
+	"github.com/bvankampen/metrics-viewer/internal/ui"
+	"github.com/urfave/cli"
+)
+
+func diffCommand() cli.Command {
+	return cli.Command{
+		Name:      "diff",
+		Usage:     "Compare two metric dumps or recordings",
+		ArgsUsage: "<before> <after>",
+		Description: "A dump is a file in the Prometheus text format, like the output of kubectl get --raw /metrics.\n" +
+			"   A recording is a directory of dumps, ordered by name and timed by their modification time.\n" +
+			"   Counters are compared by their rate when both are recordings, otherwise by their value.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format: text, json or tui",
+				Value: "text",
+			},
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Also show the series which didn't change",
+			},
+		},
+		Action: diffDumps,
+	}
+}
+
+func diffDumps(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return cli.NewExitError("expected two dumps or recordings: <before> <after>", 1)
+	}
+	before, err := diff.Load(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	after, err := diff.Load(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	result := diff.Compare(before, after, ctx.Bool("all"))
+
+	switch ctx.String("output") {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jsonSafe(result))
+	case "tui":
+		return ui.RunDiff(result)
+	case "text":
+		fmt.Printf("families: +%d -%d, series: +%d -%d\n\n",
+			len(result.AddedFamilies), len(result.RemovedFamilies), result.AddedSeries, result.RemovedSeries)
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "KIND\tMETRIC\tLABELS\tMEASURE\tBEFORE\tAFTER\tDELTA")
+		for _, c := range result.Changes {
+			if c.Kind != "changed" {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t\t\t\t\n", c.Kind, c.Metric, c.Labels)
+				continue
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Kind, c.Metric, c.Labels, c.Measure,
+				diff.FormatNumber(c.Before), diff.FormatNumber(c.After), diff.FormatNumber(c.Delta))
+		}
+		return writer.Flush()
+	}
+	return fmt.Errorf("unknown output %q, use text, json or tui", ctx.String("output"))
+}
+
+// JSON has no NaN, unknown numbers are left out like the numbers of added and removed series
+func jsonSafe(result diff.Result) interface{} {
+	type change struct {
+		diff.Change
+		Before *float64 `json:"before,omitempty"`
+		After  *float64 `json:"after,omitempty"`
+		Delta  *float64 `json:"delta,omitempty"`
+	}
+	number := func(f float64) *float64 {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil
+		}
+		return &f
+	}
+	changes := make([]change, 0, len(result.Changes))
+	for _, c := range result.Changes {
+		if c.Kind != "changed" {
+			changes = append(changes, change{Change: c})
+			continue
+		}
+		changes = append(changes, change{Change: c, Before: number(c.Before), After: number(c.After), Delta: number(c.Delta)})
+	}
+	return struct {
+		diff.Result
+		Changes []change `json:"changes"`
+	}{result, changes}
+}
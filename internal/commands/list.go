@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/kubeconfig"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/bvankampen/metrics-viewer/internal/scraper"
+	"github.com/bvankampen/metrics-viewer/internal/source"
+	"github.com/urfave/cli"
+)
+
+// Metric family as printed by the list command
+type family struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Help   string   `json:"help"`
+	Series int      `json:"series"`
+	Labels []string `json:"labels"`
+}
+
+func listCommand() cli.Command {
+	return cli.Command{
+		Name:  "list",
+		Usage: "List the metric families of the apiserver",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "grep",
+				Usage: "Only list families with a name or help text matching this regex",
+			},
+			&cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format: text or json",
+				Value: "text",
+			},
+			&cli.BoolFlag{
+				Name:  "append-to-config",
+				Usage: "Add the listed families to the metrics of the configuration file",
+			},
+		},
+		Action: list,
+	}
+}
+
+func list(ctx *cli.Context) error {
+	var grep *regexp.Regexp
+	if ctx.String("grep") != "" {
+		var err error
+		if grep, err = regexp.Compile(ctx.String("grep")); err != nil {
+			return fmt.Errorf("invalid --grep: %v", err)
+		}
+	}
+	if ctx.Bool("append-to-config") && grep == nil {
+		return fmt.Errorf("use --grep to choose the families to append to the configuration")
+	}
+
+	s, err := newSource(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := s.Scrape()
+	if err != nil {
+		return err
+	}
+	families := []family{}
+	for _, metric := range data.Metrics {
+		if grep != nil && !grep.MatchString(metric.Name) && !grep.MatchString(metric.Description) {
+			continue
+		}
+		families = append(families, newFamily(metric))
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+
+	switch ctx.String("output") {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(families); err != nil {
+			return err
+		}
+	case "text":
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tTYPE\tSERIES\tLABELS\tHELP")
+		for _, f := range families {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\n", f.Name, f.Type, f.Series, strings.Join(f.Labels, ","), f.Help)
+		}
+		writer.Flush()
+	default:
+		return fmt.Errorf("unknown output %q, use text or json", ctx.String("output"))
+	}
+
+	if ctx.Bool("append-to-config") {
+		names := make([]string, 0, len(families))
+		for _, f := range families {
+			names = append(names, f.Name)
+		}
+		added, err := config.AppendMetrics(configFilename(ctx), names)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Added %d metric(s) to %s\n", len(added), configFilename(ctx))
+	}
+	return nil
+}
+
+// Source with every metric family of the apiserver, or of the endpoint of --target or --url
+func newSource(ctx *cli.Context) (source.Source, error) {
+	if name := ctx.GlobalString("target"); name != "" {
+		appConfig, err := config.Load(configFilename(ctx))
+		if err != nil {
+			return nil, err
+		}
+		target, ok := appConfig.Target(name)
+		if !ok {
+			return nil, fmt.Errorf("target %q isn't configured", name)
+		}
+		return source.NewHTTP(target, config.ApplicationConfig{})
+	}
+	if url := ctx.GlobalString("url"); url != "" {
+		return source.NewHTTP(config.Target{URL: url}, config.ApplicationConfig{})
+	}
+	s := scraper.New(config.ApplicationConfig{}, kubeconfig.LoadKubeConfig(ctx.GlobalString("kubeconfig")))
+	s.SelectAll()
+	return s, nil
+}
+
+func newFamily(metric realtimedata.RealTimeDataMetric) family {
+	labels := make(map[string]struct{})
+	for _, value := range metric.Values {
+		for _, label := range value.Labels {
+			labels[label.Label] = struct{}{}
+		}
+	}
+	f := family{
+		Name:   metric.Name,
+		Type:   metric.Type,
+		Help:   metric.Description,
+		Series: len(metric.Values),
+		Labels: make([]string, 0, len(labels)),
+	}
+	for label := range labels {
+		f.Labels = append(f.Labels, label)
+	}
+	sort.Strings(f.Labels)
+	return f
+}
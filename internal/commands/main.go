@@ -0,0 +1,15 @@
+package commands
+
+import (
+	"github.com/urfave/cli"
+)
+
+// Subcommands of metrics-viewer, without a subcommand the viewer is started
+func Commands() []cli.Command {
+	return []cli.Command{
+		configCommand(),
+		listCommand(),
+		cardinalityCommand(),
+		diffCommand(),
+	}
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+const samplePage = `# HELP apiserver_request_total Counter of apiserver requests
+# TYPE apiserver_request_total counter
+apiserver_request_total{verb="GET",code="200"} 10
+apiserver_request_total{verb="LIST",code="200"} 5
+# HELP apiserver_current_inflight_requests Maximal number of currently used inflight request limit
+# TYPE apiserver_current_inflight_requests gauge
+apiserver_current_inflight_requests{request_kind="mutating"} 3
+# TYPE up gauge
+up 1
+`
+
+// Run metrics-viewer with the arguments and return what it printed on stdout
+func run(t *testing.T, args ...string) (string, error) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{Name: "config"},
+		&cli.StringFlag{Name: "kubeconfig"},
+		&cli.StringFlag{Name: "url"},
+		&cli.StringFlag{Name: "target"},
+	}
+	app.Commands = Commands()
+	cli.OsExiter = func(int) {} // exit errors are returned instead
+	cli.ErrWriter = io.Discard
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(reader)
+		output <- string(b)
+	}()
+	err = app.Run(append([]string{"metrics-viewer"}, args...))
+	writer.Close()
+	return <-output, err
+}
+
+func endpoint(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, samplePage)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestList(t *testing.T) {
+	url := endpoint(t)
+	out, err := run(t, "--url", url, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	expected := []string{
+		"NAME                                 TYPE     SERIES  LABELS        HELP",
+		"apiserver_current_inflight_requests  gauge    1       request_kind  Maximal number of currently used inflight request limit",
+		"apiserver_request_total              counter  2       code,verb     Counter of apiserver requests",
+		"up                                   gauge    1",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected listing:\n%s", out)
+	}
+
+	out, err = run(t, "--url", url, "list", "--grep", "inflight|Counter", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := []family{}
+	if err := json.Unmarshal([]byte(out), &families); err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 2 || families[1].Name != "apiserver_request_total" || families[1].Series != 2 {
+		t.Errorf("expected the families matching the name or help, got %+v", families)
+	}
+	if _, err := run(t, "--url", url, "list", "-o", "yaml"); err == nil {
+		t.Error("expected an error for an unknown output")
+	}
+}
+
+func TestListAppendToConfig(t *testing.T) {
+	url := endpoint(t)
+	filename := filepath.Join(t.TempDir(), "metrics-viewer.yaml")
+	if err := os.WriteFile(filename, []byte("# my metrics\nmetrics:\n  - apiserver_request_total\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, "--url", url, "--config", filename, "list", "--append-to-config"); err == nil {
+		t.Error("expected an error without --grep")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := run(t, "--url", url, "--config", filename, "list", "--grep", "^apiserver_", "--append-to-config"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	yamlConfig, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# my metrics\nmetrics:\n  - apiserver_request_total\n  - apiserver_current_inflight_requests\n"
+	if string(yamlConfig) != expected {
+		t.Errorf("expected the new family once and the comment kept, got:\n%s", yamlConfig)
+	}
+}
+
+func TestConfigInit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config", "metrics-viewer.yaml")
+	if out, err := run(t, "--config", filename, "config", "init"); err != nil || !strings.Contains(out, "written to "+filename) {
+		t.Fatalf("expected the default config to be written, got %q %v", out, err)
+	}
+	if err := os.WriteFile(filename, []byte("metrics: [up]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, "--config", filename, "config", "init"); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected an existing config not to be overwritten, got %v", err)
+	}
+	if yamlConfig, _ := os.ReadFile(filename); string(yamlConfig) != "metrics: [up]\n" {
+		t.Errorf("expected the existing config to be kept, got:\n%s", yamlConfig)
+	}
+	if _, err := run(t, "--config", filename, "config", "init", "--force"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run(t, "--config", filename, "config", "validate"); err != nil || !strings.Contains(out, "is valid") {
+		t.Errorf("expected the default config to be written and valid, got %q %v", out, err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics-viewer.yaml")
+	if err := os.WriteFile(filename, []byte("metrics: [up]\nsettings:\n  scrape_intervall: 5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(t, "--config", filename, "config", "validate")
+	if err == nil || !strings.Contains(err.Error(), "1 problem(s)") || !strings.Contains(out, "scrape_intervall") {
+		t.Errorf("expected the unknown key to be reported, got %q %v", out, err)
+	}
+}
+
+func TestConfigShowAndPath(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics-viewer.yaml")
+	yamlConfig := "metrics: [up]\ntargets:\n  - name: node\n    url: http://node:9100/metrics\n    password: secret\n"
+	if err := os.WriteFile(filename, []byte(yamlConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(t, "--config", filename, "config", "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "secret") || !strings.Contains(out, "<redacted>") || !strings.Contains(out, "scrape_interval") {
+		t.Errorf("expected the defaults and a redacted password, got:\n%s", out)
+	}
+
+	out, err = run(t, "--config", filename, "config", "path")
+	if err != nil || strings.TrimSpace(out) != filename+" (--config or METRICS_VIEWER_CONFIG, exists)" {
+		t.Errorf("unexpected path %q %v", out, err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if out, _ := run(t, "--config", missing, "config", "path"); !strings.Contains(out, "does not exist") {
+		t.Errorf("expected a missing config to be reported, got %q", out)
+	}
+}
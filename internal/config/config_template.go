@@ -2,6 +2,23 @@ package config
 
 const DEFAULT_CONFIG = `settings:
   scrape_interval: 1
+  evict_stale_after: 10
+history:
+  # directory to keep the history on disk, without it the last 600 scrapes are kept in memory
+  # path: ~/.local/share/metrics-viewer
+  retention: 24h
+  downsample_after: 1h
+  downsample_interval: 1m
+# push the scraped series to remote-write or OTLP endpoints
+# sinks:
+#   - type: remote_write
+#     url: http://prometheus:9090/api/v1/write
+#     external_labels:
+#       cluster: my-cluster
+# endpoints outside of Kubernetes, picked with --target
+# targets:
+#   - name: node
+#     url: http://localhost:9100/metrics
 metrics:
   - apiserver_flowcontrol_rejected_requests_total
   - apiserver_flowcontrol_current_inqueue_requests
@@ -10,4 +27,53 @@ metrics:
   - apiserver_flowcontrol_lower_limit_seats
   - apiserver_flowcontrol_upper_limit_seats
   - apiserver_flowcontrol_nominal_limit_seats
+views:
+  - name: APF overview
+    metrics:
+      - apiserver_flowcontrol_nominal_limit_seats
+      - apiserver_flowcontrol_current_limit_seats
+      - apiserver_flowcontrol_current_inqueue_requests
+      - apiserver_flowcontrol_current_executing_seats
+      - apiserver_flowcontrol_rejected_requests_total
+    group_by:
+      - priority_level
+    charts:
+      - metric: apiserver_flowcontrol_current_inqueue_requests
+      - metric: apiserver_flowcontrol_rejected_requests_total
+  - name: APF waits
+    metrics:
+      - apiserver_flowcontrol_request_wait_duration_seconds
+    filter: value>0
+    sort:
+      column: value
+      descending: true
+    columns:
+      - priority_level
+      - flow_schema
+      - execute
+  - name: etcd latency
+    metrics:
+      - etcd_request_duration_seconds
+      - etcd_request_errors_total
+      - apiserver_storage_objects
+    sort:
+      column: value
+      descending: true
+    columns:
+      - operation
+      - type
+      - resource
+  - name: watch cache
+    metrics:
+      - apiserver_watch_cache_events_dispatched_total
+      - apiserver_watch_cache_events_received_total
+      - apiserver_watch_cache_initializations_total
+      - apiserver_cache_list_total
+      - watch_cache_capacity
+    tree: true
+alerts:
+  - name: APF queueing
+    metric: apiserver_flowcontrol_current_inqueue_requests
+    filter: value>10
+    for: 3
 `
@@ -1,39 +1,481 @@
 package config
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/bvankampen/metrics-viewer/internal/filter"
 	"github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	DefaultScrapeInterval     = 1
+	redactedSecret            = "<redacted>"
+	DefaultEvictStaleAfter    = 10 // without the key, an explicit 0 keeps the stale series
+	DefaultDownsampleInterval = Duration(time.Minute)
+	DefaultSinkBatchSize      = 2000
+	DefaultSinkMaxRetries     = 3
+	DefaultSinkTimeout        = Duration(10 * time.Second)
+)
+
+// Protocols the scraped series can be pushed with
+var SinkTypes = []string{"remote_write", "otlp", "influx", "graphite"}
+
+// URL schemes of the sink types, influx writes over HTTP or UDP and graphite over TCP
+var sinkSchemes = map[string][]string{
+	"remote_write": {"http", "https"},
+	"otlp":         {"http", "https"},
+	"influx":       {"http", "https", "udp"},
+	"graphite":     {"tcp"},
+}
+
+// Columns which can be sorted on, in the order of the sort keys
+var SortColumns = []string{"metric", "labels", "value"}
+
+var (
+	metricNameRegex   = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegex    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	unknownFieldRegex = regexp.MustCompile(`field (\S+) not found in type .*`)
+)
+
 // Load Application Config file
 func LoadAppConfig(filename string) *ApplicationConfig {
 	filename, _ = homedir.Expand(filename)
-	applicationConfig := ApplicationConfig{}
 
 	_, err := os.Stat(filename) // create new config is not exists
 	if errors.Is(err, os.ErrNotExist) {
-		err := os.WriteFile(filename, []byte(DEFAULT_CONFIG), 0600)
-		if err != nil {
+		if err := WriteDefault(filename, false); err != nil {
 			logrus.Fatalf("Unable to create new configuration file: %v", err)
 		}
-
+		logrus.Infof("Created new configuration file: %s", filename)
 	}
 
 	logrus.Debugf("Loading configfile: %s", filename)
 
+	applicationConfig, err := Load(filename)
+	if err != nil {
+		logrus.Fatalf("Unable to load configuration: %v", err)
+	}
+	return applicationConfig
+}
+
+// Load a config file and apply the defaults, unknown keys are ignored
+func Load(filename string) (*ApplicationConfig, error) {
+	filename, _ = homedir.Expand(filename)
 	yamlConfig, err := os.ReadFile(filename)
 	if err != nil {
-		logrus.Fatalf("Unable to load configuration file: %v", err)
+		return nil, err
+	}
+	applicationConfig, err := parse(yamlConfig)
+	if err != nil {
+		return nil, err
 	}
+	for _, err := range Validate(yamlConfig) {
+		logrus.Warnf("%s: %v", filename, err)
+	}
+	return applicationConfig, nil
+}
+
+// Unmarshal a config and apply the defaults, the defaults of missing keys are set before unmarshalling
+// or, for the entries of lists, looked up with pointers
+func parse(yamlConfig []byte) (*ApplicationConfig, error) {
+	applicationConfig := ApplicationConfig{}
+	applicationConfig.Settings.EvictStaleAfter = DefaultEvictStaleAfter
+	if err := yaml.Unmarshal(yamlConfig, &applicationConfig); err != nil {
+		return nil, err
+	}
+	applicationConfig.applyDefaults()
+
+	// max_retries: 0 disables retries
+	sinks := struct {
+		Sinks []struct {
+			MaxRetries *int `yaml:"max_retries"`
+		} `yaml:"sinks"`
+	}{}
+	_ = yaml.Unmarshal(yamlConfig, &sinks)
+	for i, sink := range sinks.Sinks {
+		if sink.MaxRetries == nil && i < len(applicationConfig.Sinks) {
+			applicationConfig.Sinks[i].MaxRetries = DefaultSinkMaxRetries
+		}
+	}
+	return &applicationConfig, nil
+}
 
-	err = yaml.Unmarshal(yamlConfig, &applicationConfig)
+// Write the default config, an existing file is only overwritten with force
+func WriteDefault(filename string, force bool) error {
+	filename, _ = homedir.Expand(filename)
+	if _, err := os.Stat(filename); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", filename)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(DEFAULT_CONFIG), 0600)
+}
+
+// Add metrics to the metrics list of a config file, keeping its comments and layout.
+// Returns the metrics which weren't configured yet.
+func AppendMetrics(filename string, metrics []string) ([]string, error) {
+	filename, _ = homedir.Expand(filename)
+	yamlConfig, err := os.ReadFile(filename)
 	if err != nil {
-		logrus.Fatalf("Unable to load configuration: %v", err)
+		return nil, err
+	}
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(yamlConfig, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 { // empty file
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a mapping at the top level", filename)
+	}
+
+	var list *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "metrics" {
+			list = root.Content[i+1]
+		}
+	}
+	switch {
+	case list == nil:
+		list = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "metrics"}, list)
+	case list.Kind == yaml.ScalarNode && list.Tag == "!!null": // "metrics:" without entries
+		*list = yaml.Node{Kind: yaml.SequenceNode}
+	case list.Kind != yaml.SequenceNode:
+		return nil, fmt.Errorf("%s: metrics must be a list", filename)
+	}
+
+	configured := make(map[string]struct{}, len(list.Content))
+	for _, m := range list.Content {
+		configured[m.Value] = struct{}{}
+	}
+	added := []string{}
+	for _, m := range metrics {
+		if _, ok := configured[m]; ok {
+			continue
+		}
+		configured[m] = struct{}{}
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: m})
+		added = append(added, m)
+	}
+	if len(added) == 0 {
+		return added, nil
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	return added, os.WriteFile(filename, out.Bytes(), 0600)
+}
+
+// Validate a config strictly, returns all problems found
+func Validate(yamlConfig []byte) []error {
+	errs := []error{}
+
+	applicationConfig := ApplicationConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(yamlConfig))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&applicationConfig); err != nil && !errors.Is(err, io.EOF) {
+		var typeError *yaml.TypeError
+		if !errors.As(err, &typeError) {
+			return append(errs, err)
+		}
+		for _, e := range typeError.Errors {
+			errs = append(errs, errors.New(unknownFieldRegex.ReplaceAllString(e, `unknown key "$1"`)))
+		}
+	}
+
+	// pointers to see which settings are set
+	settings := struct {
+		Settings struct {
+			ScrapeInterval  *int `yaml:"scrape_interval"`
+			EvictStaleAfter *int `yaml:"evict_stale_after"`
+		} `yaml:"settings"`
+	}{}
+	_ = yaml.Unmarshal(yamlConfig, &settings)
+	if i := settings.Settings.ScrapeInterval; i != nil && *i < 1 {
+		errs = append(errs, fmt.Errorf("settings.scrape_interval must be at least 1 second, got %d", *i))
+	}
+	if e := settings.Settings.EvictStaleAfter; e != nil && *e < 0 {
+		errs = append(errs, fmt.Errorf("settings.evict_stale_after can't be negative, got %d", *e))
+	}
+
+	if len(applicationConfig.AllMetrics()) == 0 {
+		errs = append(errs, errors.New("no metrics configured"))
+	}
+	errs = append(errs, validateMetrics("metrics", applicationConfig.Metrics)...)
+
+	views := make(map[string]struct{}, len(applicationConfig.Views))
+	for i, view := range applicationConfig.Views {
+		if view.Name == "" {
+			errs = append(errs, fmt.Errorf("views[%d] has no name", i))
+		}
+		if _, ok := views[view.Name]; ok {
+			errs = append(errs, fmt.Errorf("view %q is configured more than once", view.Name))
+		}
+		views[view.Name] = struct{}{}
+		errs = append(errs, validateMetrics(fmt.Sprintf("view %q", view.Name), view.Metrics)...)
+		if strings.TrimSpace(view.Filter) != "" { // without the regex fallback of the UI, so a typo isn't taken as a regex
+			if _, err := filter.Parse(view.Filter); err != nil {
+				errs = append(errs, fmt.Errorf("view %q: invalid filter: %v", view.Name, err))
+			}
+		}
+		if view.Sort.ColumnIndex() < 0 {
+			errs = append(errs, fmt.Errorf("view %q: sort column must be one of %s", view.Name, strings.Join(SortColumns, ", ")))
+		}
+		for j, chart := range view.Charts {
+			errs = append(errs, validateMetrics(fmt.Sprintf("view %q charts[%d]", view.Name, j), []string{chart.Metric})...)
+			if strings.TrimSpace(chart.Filter) != "" {
+				if _, err := filter.Parse(chart.Filter); err != nil {
+					errs = append(errs, fmt.Errorf("view %q charts[%d]: invalid filter: %v", view.Name, j, err))
+				}
+			}
+		}
+	}
+	alerts := make(map[string]struct{}, len(applicationConfig.Alerts))
+	for i, alert := range applicationConfig.Alerts {
+		if alert.Name == "" {
+			errs = append(errs, fmt.Errorf("alerts[%d] has no name", i))
+		}
+		if _, ok := alerts[alert.Name]; ok {
+			errs = append(errs, fmt.Errorf("alert %q is configured more than once", alert.Name))
+		}
+		alerts[alert.Name] = struct{}{}
+		errs = append(errs, validateMetrics(fmt.Sprintf("alert %q", alert.Name), []string{alert.Metric})...)
+		if strings.TrimSpace(alert.Filter) != "" {
+			if _, err := filter.Parse(alert.Filter); err != nil {
+				errs = append(errs, fmt.Errorf("alert %q: invalid filter: %v", alert.Name, err))
+			}
+		}
+		if alert.For < 0 {
+			errs = append(errs, fmt.Errorf("alert %q: for can't be negative", alert.Name))
+		}
+	}
+	for i, sink := range applicationConfig.Sinks {
+		errs = append(errs, validateSink(fmt.Sprintf("sinks[%d]", i), sink)...)
+	}
+
+	targets := make(map[string]struct{}, len(applicationConfig.Targets))
+	for i, target := range applicationConfig.Targets {
+		if target.Name == "" {
+			errs = append(errs, fmt.Errorf("targets[%d] has no name", i))
+		}
+		if _, ok := targets[target.Name]; ok {
+			errs = append(errs, fmt.Errorf("target %q is configured more than once", target.Name))
+		}
+		targets[target.Name] = struct{}{}
+		errs = append(errs, ValidateTarget(fmt.Sprintf("target %q", target.Name), target)...)
+	}
+	return errs
+}
+
+// Validate the URL and the authentication of a target
+func ValidateTarget(context string, target Target) []error {
+	errs := []error{}
+	if u, err := url.Parse(target.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		errs = append(errs, fmt.Errorf("%s: invalid http or https url %q", context, target.URL))
+	}
+	if target.Password != "" && target.PasswordFile != "" {
+		errs = append(errs, fmt.Errorf("%s: password and password_file can't both be set", context))
+	}
+	if target.Username != "" && target.BearerTokenFile != "" {
+		errs = append(errs, fmt.Errorf("%s: username and bearer_token_file can't both be set", context))
+	}
+	if (target.CertFile == "") != (target.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("%s: cert_file and key_file must be set together", context))
+	}
+	return errs
+}
+
+func validateSink(context string, sink Sink) []error {
+	errs := []error{}
+	if !slices.Contains(SinkTypes, sink.Type) {
+		errs = append(errs, fmt.Errorf("%s: type must be one of %s, got %q", context, strings.Join(SinkTypes, ", "), sink.Type))
+	}
+	if u, err := url.Parse(sink.URL); err != nil || u.Host == "" {
+		errs = append(errs, fmt.Errorf("%s: invalid url %q", context, sink.URL))
+	} else if schemes, ok := sinkSchemes[sink.Type]; ok && !slices.Contains(schemes, u.Scheme) {
+		errs = append(errs, fmt.Errorf("%s: url scheme of a %s sink must be one of %s, got %q", context, sink.Type, strings.Join(schemes, ", "), u.Scheme))
+	}
+	for name := range sink.ExternalLabels {
+		if !labelNameRegex.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%s: %q is not a valid label name", context, name))
+		}
+	}
+	if sink.BatchSize < 0 || sink.MaxRetries < 0 || sink.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("%s: batch_size, max_retries and timeout can't be negative", context))
+	}
+	return errs
+}
+
+func validateMetrics(context string, metrics []string) []error {
+	errs := []error{}
+	seen := make(map[string]struct{}, len(metrics))
+	for _, m := range metrics {
+		if !metricNameRegex.MatchString(m) {
+			errs = append(errs, fmt.Errorf("%s: %q is not a valid metric name", context, m))
+		}
+		if _, ok := seen[m]; ok {
+			errs = append(errs, fmt.Errorf("%s: %q is configured more than once", context, m))
+		}
+		seen[m] = struct{}{}
+	}
+	return errs
+}
+
+// Metrics of the config, of all views and their charts and of the alerts, without duplicates
+func (c *ApplicationConfig) AllMetrics() []string {
+	metrics := []string{}
+	seen := make(map[string]struct{})
+	add := func(names []string) {
+		for _, m := range names {
+			if _, ok := seen[m]; !ok {
+				seen[m] = struct{}{}
+				metrics = append(metrics, m)
+			}
+		}
+	}
+	add(c.Metrics)
+	for _, view := range c.Views {
+		add(view.Metrics)
+		for _, chart := range view.Charts {
+			add([]string{chart.Metric})
+		}
+	}
+	for _, alert := range c.Alerts {
+		add([]string{alert.Metric})
+	}
+	return metrics
+}
+
+// Configured target by name
+func (c *ApplicationConfig) Target(name string) (Target, bool) {
+	for _, target := range c.Targets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return Target{}, false
+}
+
+// Column number of the sort column, -1 if it is unknown
+func (s ViewSort) ColumnIndex() int {
+	if s.Column == "" {
+		return 0
+	}
+	for i, c := range SortColumns {
+		if c == s.Column {
+			return i
+		}
+	}
+	return -1
+}
+
+// Effective config as YAML with the passwords, header values and url passwords redacted
+func (c *ApplicationConfig) String() string {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.redacted()); err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// Copy of the config without secrets, the files with secrets are only paths and are kept
+func (c *ApplicationConfig) redacted() ApplicationConfig {
+	redacted := *c
+	redacted.Targets = make([]Target, len(c.Targets))
+	for i, target := range c.Targets {
+		if target.Password != "" {
+			target.Password = redactedSecret
+		}
+		target.URL = redactURL(target.URL)
+		target.Headers = redactHeaders(target.Headers)
+		redacted.Targets[i] = target
+	}
+	redacted.Sinks = make([]Sink, len(c.Sinks))
+	for i, sink := range c.Sinks {
+		sink.URL = redactURL(sink.URL)
+		sink.Headers = redactHeaders(sink.Headers)
+		redacted.Sinks[i] = sink
+	}
+	return redacted
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	redacted := make(map[string]string, len(headers))
+	for name := range headers {
+		redacted[name] = redactedSecret
+	}
+	return redacted
+}
+
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+func (c *ApplicationConfig) applyDefaults() {
+	if c.Settings.ScrapeInterval < 1 {
+		c.Settings.ScrapeInterval = DefaultScrapeInterval
+	}
+	if c.Settings.EvictStaleAfter < 0 {
+		c.Settings.EvictStaleAfter = 0
+	}
+	if c.History.DownsampleInterval <= 0 {
+		c.History.DownsampleInterval = DefaultDownsampleInterval
+	}
+	for i := range c.Sinks {
+		if c.Sinks[i].BatchSize <= 0 {
+			c.Sinks[i].BatchSize = DefaultSinkBatchSize
+		}
+		if c.Sinks[i].MaxRetries < 0 {
+			c.Sinks[i].MaxRetries = 0
+		}
+		if c.Sinks[i].Timeout <= 0 {
+			c.Sinks[i].Timeout = DefaultSinkTimeout
+		}
 	}
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	duration, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q, use a duration like 30m or 24h", node.Line, node.Value)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
 
-	return &applicationConfig
+func (d Duration) String() string {
+	return time.Duration(d).String()
 }
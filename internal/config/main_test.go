@@ -0,0 +1,116 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateViewFilter(t *testing.T) {
+	for _, test := range []struct {
+		filter string
+		valid  bool
+	}{
+		{"", true},
+		{"value>0 AND verb=GET", true},
+		{"priority_level=~workload.*", true},
+		{"value>", false},
+		{"(verb=GET", false},
+		{"verb=GET AND", false},
+	} {
+		yamlConfig := "metrics:\n  - up\nviews:\n  - name: test\n    filter: '" + test.filter + "'\n"
+		errs := Validate([]byte(yamlConfig))
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("filter %q: expected valid %v, got %v", test.filter, test.valid, errs)
+		}
+		for _, err := range errs {
+			if !strings.Contains(err.Error(), "invalid filter") {
+				t.Errorf("filter %q: unexpected error %v", test.filter, err)
+			}
+		}
+	}
+}
+
+func TestSinkMaxRetries(t *testing.T) {
+	yamlConfig := `sinks:
+  - type: remote_write
+    url: http://a
+  - type: remote_write
+    url: http://b
+    max_retries: 0
+  - type: remote_write
+    url: http://c
+    max_retries: 5
+`
+	c, err := parse([]byte(yamlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int{DefaultSinkMaxRetries, 0, 5} {
+		if c.Sinks[i].MaxRetries != expected {
+			t.Errorf("sink %d: expected %d retries, got %d", i, expected, c.Sinks[i].MaxRetries)
+		}
+	}
+	// the shown config reads back the same
+	shown, err := parse([]byte(c.String()))
+	if err != nil || shown.Sinks[1].MaxRetries != 0 {
+		t.Errorf("expected max_retries: 0 to be kept by config show, got %+v %v", shown.Sinks, err)
+	}
+}
+
+func TestValidateAlerts(t *testing.T) {
+	for _, test := range []struct {
+		alerts string
+		error  string
+	}{
+		{"  - name: queued\n    metric: apiserver_flowcontrol_current_inqueue_requests\n    filter: value>10\n    for: 3\n", ""},
+		{"  - metric: up\n", "name"},
+		{"  - name: a\n    metric: up\n  - name: a\n    metric: up\n", "more than once"},
+		{"  - name: a\n    metric: up\n    filter: 'value>'\n", "invalid filter"},
+		{"  - name: a\n    metric: up\n    for: -1\n", "for"},
+	} {
+		errs := Validate([]byte("metrics:\n  - up\nalerts:\n" + test.alerts))
+		if test.error == "" {
+			if len(errs) != 0 {
+				t.Errorf("%q: expected valid, got %v", test.alerts, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), test.error) {
+			t.Errorf("%q: expected one error about %q, got %v", test.alerts, test.error, errs)
+		}
+	}
+
+	c, err := parse([]byte("metrics:\n  - up\nalerts:\n  - name: a\n    metric: apiserver_flowcontrol_current_inqueue_requests\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics := c.AllMetrics(); len(metrics) != 2 || metrics[1] != "apiserver_flowcontrol_current_inqueue_requests" {
+		t.Errorf("expected the alert metric to be scraped, got %v", metrics)
+	}
+}
+
+func TestValidateCharts(t *testing.T) {
+	yamlConfig := `metrics:
+  - up
+views:
+  - name: apf
+    charts:
+      - metric: apiserver_flowcontrol_current_inqueue_requests
+        filter: priority_level=workload-low
+      - metric: not-a-metric
+      - metric: up
+        filter: 'value>'
+`
+	errs := Validate([]byte(yamlConfig))
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), `charts[1]: "not-a-metric" is not a valid metric name`) || !strings.Contains(errs[1].Error(), "charts[2]: invalid filter") {
+		t.Errorf("expected an invalid metric and filter, got %v", errs)
+	}
+
+	c, err := parse([]byte(yamlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics := c.AllMetrics(); len(metrics) != 3 || metrics[1] != "apiserver_flowcontrol_current_inqueue_requests" {
+		t.Errorf("expected the chart metrics to be scraped, got %v", metrics)
+	}
+}
@@ -1,8 +1,88 @@
 package config
 
+import "time"
+
 type ApplicationConfig struct {
-	Metrics  []string `yaml:"metrics"`
 	Settings struct {
-		ScrapeInterval int `yaml:"scrape_interval"`
+		ScrapeInterval  int `yaml:"scrape_interval"`
+		EvictStaleAfter int `yaml:"evict_stale_after"` // number of missing scrapes, 0 keeps stale series
 	} `yaml:"settings"`
+	History History  `yaml:"history,omitempty"`
+	Metrics []string `yaml:"metrics"`
+	Views   []View   `yaml:"views,omitempty"`
+	Alerts  []Alert  `yaml:"alerts,omitempty"`
+	Sinks   []Sink   `yaml:"sinks,omitempty"`
+	Targets []Target `yaml:"targets,omitempty"`
+}
+
+// History of the series, without a path only the last scrapes are kept in memory
+type History struct {
+	Path               string   `yaml:"path,omitempty"`
+	Retention          Duration `yaml:"retention,omitempty"`        // 0 keeps all samples
+	DownsampleAfter    Duration `yaml:"downsample_after,omitempty"` // 0 never downsamples
+	DownsampleInterval Duration `yaml:"downsample_interval,omitempty"`
+}
+
+// Destination the scraped series are pushed to
+type Sink struct {
+	Type           string            `yaml:"type"` // one of SinkTypes
+	URL            string            `yaml:"url"`
+	ExternalLabels map[string]string `yaml:"external_labels,omitempty"` // added to every series, like the cluster name
+	Headers        map[string]string `yaml:"headers,omitempty"`         // like Authorization
+	BatchSize      int               `yaml:"batch_size,omitempty"`      // series per request
+	MaxRetries     int               `yaml:"max_retries"`               // 0 disables retries
+	Timeout        Duration          `yaml:"timeout,omitempty"`         // per request
+	// influx and graphite only
+	Prefix        string            `yaml:"prefix,omitempty"`         // added to the metric names
+	NameSeparator string            `yaml:"name_separator,omitempty"` // replaces the _ in metric names, like . for graphite paths
+	Tags          map[string]string `yaml:"tags,omitempty"`           // label -> tag name, only these labels are sent, empty sends all labels
+}
+
+// Prometheus endpoint outside of Kubernetes, picked with --target
+type Target struct {
+	Name               string            `yaml:"name"`
+	URL                string            `yaml:"url"`
+	Username           string            `yaml:"username,omitempty"` // basic auth
+	Password           string            `yaml:"password,omitempty"`
+	PasswordFile       string            `yaml:"password_file,omitempty"`
+	BearerTokenFile    string            `yaml:"bearer_token_file,omitempty"` // read every scrape, so a rotated token is used
+	CAFile             string            `yaml:"ca_file,omitempty"`
+	CertFile           string            `yaml:"cert_file,omitempty"` // client certificate
+	KeyFile            string            `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify,omitempty"`
+	Headers            map[string]string `yaml:"headers,omitempty"`
+}
+
+// Duration written like 1h30m in the config
+type Duration time.Duration
+
+// Named view with its own metrics and presets for the UI
+type View struct {
+	Name    string   `yaml:"name"`
+	Metrics []string `yaml:"metrics,omitempty"` // empty shows all metrics
+	Filter  string   `yaml:"filter,omitempty"`
+	Sort    ViewSort `yaml:"sort,omitempty"`
+	GroupBy []string `yaml:"group_by,omitempty"`
+	Columns []string `yaml:"columns,omitempty"` // label columns in order, enables the columnar mode
+	Tree    bool     `yaml:"tree,omitempty"`
+	Charts  []Chart  `yaml:"charts,omitempty"` // shown under the table
+}
+
+// Chart of the sum of the matching series of a metric, counters are charted as a rate
+type Chart struct {
+	Metric string `yaml:"metric"`           // scraped like the metrics of the view
+	Filter string `yaml:"filter,omitempty"` // empty sums every series of the metric
+}
+
+// Alert rule, fires when series of the metric match the filter for a number of scrapes in a row
+type Alert struct {
+	Name   string `yaml:"name"`
+	Metric string `yaml:"metric"`           // scraped like the configured metrics
+	Filter string `yaml:"filter,omitempty"` // empty matches every series of the metric
+	For    int    `yaml:"for,omitempty"`    // scrapes in a row, 0 or 1 fires at the first match
+}
+
+type ViewSort struct {
+	Column     string `yaml:"column,omitempty"` // metric, labels or value
+	Descending bool   `yaml:"descending,omitempty"`
 }
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+)
+
+// Editors write a file in several steps, wait for these to settle before reloading
+const reloadDelay = 250 * time.Millisecond
+
+// Load a changed config, unlike Load any validation problem is an error
+func Reload(filename string) (*ApplicationConfig, error) {
+	filename, _ = homedir.Expand(filename)
+	yamlConfig, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if errs := Validate(yamlConfig); len(errs) > 0 {
+		if len(errs) > 1 {
+			return nil, fmt.Errorf("%v (and %d more problems)", errs[0], len(errs)-1)
+		}
+		return nil, errs[0]
+	}
+	return parse(yamlConfig)
+}
+
+// Watch the config file and call the handler with the reloaded config or the reload error
+func Watch(filename string, handler func(*ApplicationConfig, error)) error {
+	filename, _ = homedir.Expand(filename)
+	filename = filepath.Clean(filename)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch the directory, editors often replace the file instead of writing it
+	if err := watcher.Add(filepath.Dir(filename)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filename || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDelay, func() {
+					logrus.Debugf("Reloading configfile: %s", filename)
+					handler(Reload(filename))
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Debugf("Error watching configfile: %v", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,229 @@
+package diff
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+var quantiles = []struct {
+	name string
+	q    float64
+}{{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}}
+
+// Load a dump in the Prometheus text format or a recording, a directory of dumps in the order of their names.
+// The modification time of a dump is the time of its scrape.
+func Load(path string) (Side, error) {
+	side := Side{Path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return side, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return side, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		if len(files) == 0 {
+			return side, fmt.Errorf("%s has no dumps", path)
+		}
+		sort.Strings(files)
+	}
+
+	data := realtimedata.RealTimeData{}
+	for i, file := range files {
+		if err := parseFile(&data, file); err != nil {
+			return side, err
+		}
+		if i == 0 {
+			side.First = data.Snapshot()
+		}
+	}
+	side.Last = data.Snapshot()
+	side.Duration = side.Last.Time.Sub(side.First.Time)
+	return side, nil
+}
+
+func parseFile(data *realtimedata.RealTimeData, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	data.NextGeneration()
+	data.Time = info.ModTime()
+	if err := data.Parse(f, nil); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// Compare two sides, with all unchanged series are included as well
+func Compare(before, after Side, all bool) Result {
+	result := Result{Before: before.Path, After: after.Path, AddedFamilies: []string{}, RemovedFamilies: []string{}, Changes: []Change{}}
+	beforeMetrics := metricsByName(before.Last)
+	afterMetrics := metricsByName(after.Last)
+	beforeFirst := valuesByName(before.First)
+	afterFirst := valuesByName(after.First)
+
+	for _, metric := range after.Last.Metrics {
+		if _, ok := beforeMetrics[metric.Name]; !ok {
+			result.AddedFamilies = append(result.AddedFamilies, metric.Name)
+			result.AddedSeries += len(metric.Values)
+			result.Changes = append(result.Changes, Change{Kind: "added", Metric: metric.Name, Type: metric.Type})
+		}
+	}
+	for _, metric := range before.Last.Metrics {
+		a, ok := afterMetrics[metric.Name]
+		if !ok {
+			result.RemovedFamilies = append(result.RemovedFamilies, metric.Name)
+			result.RemovedSeries += len(metric.Values)
+			result.Changes = append(result.Changes, Change{Kind: "removed", Metric: metric.Name, Type: metric.Type})
+			continue
+		}
+		b := metric
+		beforeValues := valuesByHash(b)
+		afterValues := valuesByHash(*a)
+		for _, v := range a.Values {
+			if _, ok := beforeValues[v.Hash]; !ok {
+				result.AddedSeries++
+				result.Changes = append(result.Changes, Change{Kind: "added", Metric: a.Name, Type: a.Type, Labels: labelsToString(v.Labels)})
+			}
+		}
+		for i := range b.Values {
+			v := &b.Values[i]
+			av, ok := afterValues[v.Hash]
+			if !ok {
+				result.RemovedSeries++
+				result.Changes = append(result.Changes, Change{Kind: "removed", Metric: b.Name, Type: b.Type, Labels: labelsToString(v.Labels)})
+				continue
+			}
+			beforeStart := beforeFirst[b.Name][v.Hash]
+			afterStart := afterFirst[a.Name][v.Hash]
+			for _, change := range compareValues(a.Type, v, av, beforeStart, afterStart, before.Duration, after.Duration) {
+				if !all && (change.Delta == 0 || (math.IsNaN(change.Before) && math.IsNaN(change.After))) {
+					continue
+				}
+				change.Kind = "changed"
+				change.Metric = a.Name
+				change.Type = a.Type
+				change.Labels = labelsToString(v.Labels)
+				result.Changes = append(result.Changes, change)
+			}
+		}
+	}
+	sort.Strings(result.AddedFamilies)
+	sort.Strings(result.RemovedFamilies)
+	sort.SliceStable(result.Changes, func(i, j int) bool {
+		if result.Changes[i].Metric != result.Changes[j].Metric {
+			return result.Changes[i].Metric < result.Changes[j].Metric
+		}
+		return result.Changes[i].Labels < result.Changes[j].Labels
+	})
+	return result
+}
+
+// Counters compare their rate if both sides are recordings and their value otherwise,
+// histograms compare their quantiles over the recording or since the start of the process
+func compareValues(metricType string, before, after *realtimedata.RealTimeDataMetricValue, beforeStart, afterStart *realtimedata.RealTimeDataMetricValue, beforeDuration, afterDuration time.Duration) []Change {
+	switch {
+	case metricType == "counter" && beforeDuration > 0 && afterDuration > 0:
+		return []Change{newChange("rate", rate(before, beforeStart, beforeDuration), rate(after, afterStart, afterDuration))}
+	case metricType == "histogram":
+		beforeBuckets := before.Buckets
+		afterBuckets := after.Buckets
+		if beforeDuration > 0 && afterDuration > 0 && beforeStart != nil && afterStart != nil {
+			beforeBuckets = realtimedata.DeltaBuckets(before.Buckets, beforeStart.Buckets)
+			afterBuckets = realtimedata.DeltaBuckets(after.Buckets, afterStart.Buckets)
+		}
+		changes := make([]Change, 0, len(quantiles))
+		for _, q := range quantiles {
+			changes = append(changes, newChange(q.name, realtimedata.Quantile(q.q, beforeBuckets), realtimedata.Quantile(q.q, afterBuckets)))
+		}
+		return changes
+	}
+	return []Change{newChange("value", parseFloat(before.Value), parseFloat(after.Value))}
+}
+
+func newChange(measure string, before, after float64) Change {
+	return Change{Measure: measure, Before: before, After: after, Delta: after - before}
+}
+
+// Increase per second over a recording, NaN after a counter reset
+func rate(last, first *realtimedata.RealTimeDataMetricValue, duration time.Duration) float64 {
+	if first == nil {
+		return math.NaN()
+	}
+	increase := parseFloat(last.Value) - parseFloat(first.Value)
+	if increase < 0 {
+		return math.NaN()
+	}
+	return increase / duration.Seconds()
+}
+
+func metricsByName(data realtimedata.RealTimeData) map[string]*realtimedata.RealTimeDataMetric {
+	metrics := make(map[string]*realtimedata.RealTimeDataMetric, len(data.Metrics))
+	for i := range data.Metrics {
+		metrics[data.Metrics[i].Name] = &data.Metrics[i]
+	}
+	return metrics
+}
+
+func valuesByHash(metric realtimedata.RealTimeDataMetric) map[uint64]*realtimedata.RealTimeDataMetricValue {
+	values := make(map[uint64]*realtimedata.RealTimeDataMetricValue, len(metric.Values))
+	for i := range metric.Values {
+		values[metric.Values[i].Hash] = &metric.Values[i]
+	}
+	return values
+}
+
+func valuesByName(data realtimedata.RealTimeData) map[string]map[uint64]*realtimedata.RealTimeDataMetricValue {
+	values := make(map[string]map[uint64]*realtimedata.RealTimeDataMetricValue, len(data.Metrics))
+	for _, metric := range data.Metrics {
+		values[metric.Name] = valuesByHash(metric)
+	}
+	return values
+}
+
+// Number with 6 significant digits, small latencies don't fit in a fixed number of decimals.
+// Unknown numbers (NaN) are shown as -
+func FormatNumber(f float64) string {
+	if math.IsNaN(f) {
+		return "-"
+	}
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func labelsToString(labels []realtimedata.RealTimeDataMetricLabel) string {
+	parts := make([]string, 0, len(labels))
+	for _, label := range labels {
+		parts = append(parts, fmt.Sprintf("%s=%q", label.Label, label.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,108 @@
+package diff
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A dump of one page, or a recording of several pages 10 seconds apart
+func side(t *testing.T, pages ...string) Side {
+	path := filepath.Join(t.TempDir(), "dump.prom")
+	if len(pages) > 1 {
+		path = filepath.Dir(path)
+	}
+	start := time.Unix(1700000000, 0)
+	for i, page := range pages {
+		file := path
+		if len(pages) > 1 {
+			file = filepath.Join(path, fmt.Sprintf("%02d.prom", i))
+		}
+		if err := os.WriteFile(file, []byte(page), 0600); err != nil {
+			t.Fatal(err)
+		}
+		at := start.Add(time.Duration(i) * 10 * time.Second)
+		if err := os.Chtimes(file, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func gauge(value string) string {
+	return "# TYPE inflight gauge\ninflight{kind=\"mutating\"} " + value + "\n"
+}
+
+func counter(value string) string {
+	return "# TYPE requests_total counter\nrequests_total{verb=\"GET\"} " + value + "\n"
+}
+
+func histogram(fast, slow string) string {
+	return "# TYPE wait_seconds histogram\n" +
+		"wait_seconds_bucket{le=\"0.1\"} " + fast + "\n" +
+		"wait_seconds_bucket{le=\"1\"} " + slow + "\n" +
+		"wait_seconds_bucket{le=\"+Inf\"} " + slow + "\n" +
+		"wait_seconds_sum 1\nwait_seconds_count " + slow + "\n"
+}
+
+func sameNumber(a, b float64) bool {
+	return (math.IsNaN(a) && math.IsNaN(b)) || math.Abs(a-b) < 1e-9
+}
+
+func TestCompare(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		before, after []string
+		measure       string
+		want          [2]float64 // before and after
+	}{
+		{"gauge delta", []string{gauge("5")}, []string{gauge("8")}, "value", [2]float64{5, 8}},
+		{"counter values of dumps", []string{counter("100")}, []string{counter("400")}, "value", [2]float64{100, 400}},
+		{"counter rates of recordings", []string{counter("100"), counter("200")}, []string{counter("100"), counter("400")}, "rate", [2]float64{10, 30}},
+		{"counter reset", []string{counter("100"), counter("200")}, []string{counter("300"), counter("100")}, "rate", [2]float64{10, math.NaN()}},
+		{"histogram quantile of dumps", []string{histogram("90", "100")}, []string{histogram("10", "100")}, "p50", [2]float64{0.1 * 50 / 90, 0.5}},
+		{"histogram quantile of recordings", []string{histogram("0", "0"), histogram("90", "100")}, []string{histogram("90", "100"), histogram("100", "200")}, "p50", [2]float64{0.1 * 50 / 90, 0.5}},
+	} {
+		result := Compare(side(t, test.before...), side(t, test.after...), false)
+		var found bool
+		for _, change := range result.Changes {
+			if change.Kind != "changed" || change.Measure != test.measure {
+				continue
+			}
+			found = true
+			if !sameNumber(change.Before, test.want[0]) || !sameNumber(change.After, test.want[1]) {
+				t.Errorf("%s: expected %v, got %v -> %v", test.name, test.want, change.Before, change.After)
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected a %s change, got %+v", test.name, test.measure, result.Changes)
+		}
+	}
+}
+
+func TestCompareSeries(t *testing.T) {
+	before := side(t, gauge("1")+counter("1"))
+	after := side(t, gauge("1")+"inflight{kind=\"readOnly\"} 2\n"+histogram("1", "1"))
+	result := Compare(before, after, false)
+	if fmt.Sprint(result.AddedFamilies, result.RemovedFamilies) != "[wait_seconds] [requests_total]" {
+		t.Errorf("unexpected added and removed families %v %v", result.AddedFamilies, result.RemovedFamilies)
+	}
+	if result.AddedSeries != 2 || result.RemovedSeries != 1 {
+		t.Errorf("expected 2 added and 1 removed series, got %d and %d", result.AddedSeries, result.RemovedSeries)
+	}
+	for _, change := range result.Changes {
+		if change.Kind == "changed" {
+			t.Errorf("expected the unchanged gauge to be left out, got %+v", change)
+		}
+	}
+	if all := Compare(before, after, true); len(all.Changes) != len(result.Changes)+1 {
+		t.Errorf("expected the unchanged gauge with all, got %+v", all.Changes)
+	}
+}
@@ -0,0 +1,36 @@
+package diff
+
+import (
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// A dump or the first and last scrape of a recording
+type Side struct {
+	Path     string
+	First    realtimedata.RealTimeData
+	Last     realtimedata.RealTimeData
+	Duration time.Duration // time between the first and last scrape, 0 for a single dump
+}
+
+type Change struct {
+	Kind    string  `json:"kind"` // added, removed or changed
+	Metric  string  `json:"metric"`
+	Type    string  `json:"type"`
+	Labels  string  `json:"labels,omitempty"`  // empty for added or removed families
+	Measure string  `json:"measure,omitempty"` // value, rate, p50, p90 or p99
+	Before  float64 `json:"before"`
+	After   float64 `json:"after"`
+	Delta   float64 `json:"delta"`
+}
+
+type Result struct {
+	Before          string   `json:"before"`
+	After           string   `json:"after"`
+	AddedFamilies   []string `json:"addedFamilies"`
+	RemovedFamilies []string `json:"removedFamilies"`
+	AddedSeries     int      `json:"addedSeries"`
+	RemovedSeries   int      `json:"removedSeries"`
+	Changes         []Change `json:"changes"`
+}
@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	scrapeAnnotation = "prometheus.io/scrape"
+	schemeAnnotation = "prometheus.io/scheme"
+	portAnnotation   = "prometheus.io/port"
+	pathAnnotation   = "prometheus.io/path"
+
+	defaultPath = "/metrics"
+)
+
+// The /metrics endpoint of the apiserver
+var APIServer = Target{Kind: "apiserver", Path: defaultPath}
+
+func New(restConfig *rest.Config) (*Discovery, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Discovery{clientset: clientset}, nil
+}
+
+// Annotated pods and services of a namespace, an empty namespace means all namespaces
+func (d *Discovery) Targets(ctx context.Context, namespace string) ([]Target, error) {
+	targets := []Target{}
+
+	pods, err := d.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		if target, ok := annotatedTarget("pod", pod.ObjectMeta); ok {
+			if target.Port == "" {
+				target.Port = firstContainerPort(pod)
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	services, err := d.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %v", err)
+	}
+	for _, service := range services.Items {
+		if target, ok := annotatedTarget("service", service.ObjectMeta); ok {
+			if target.Port == "" && len(service.Spec.Ports) > 0 {
+				target.Port = strconv.Itoa(int(service.Spec.Ports[0].Port))
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].String() < targets[j].String()
+	})
+	return targets, nil
+}
+
+func annotatedTarget(kind string, meta metav1.ObjectMeta) (Target, bool) {
+	if meta.Annotations[scrapeAnnotation] != "true" {
+		return Target{}, false
+	}
+	target := Target{
+		Kind:      kind,
+		Namespace: meta.Namespace,
+		Name:      meta.Name,
+		Scheme:    meta.Annotations[schemeAnnotation],
+		Port:      meta.Annotations[portAnnotation],
+		Path:      meta.Annotations[pathAnnotation],
+	}
+	if target.Path == "" {
+		target.Path = defaultPath
+	}
+	if !strings.HasPrefix(target.Path, "/") {
+		target.Path = "/" + target.Path
+	}
+	return target, true
+}
+
+func firstContainerPort(pod corev1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			return strconv.Itoa(int(port.ContainerPort))
+		}
+	}
+	return ""
+}
+
+// Path on the apiserver, pods and services are scraped through the proxy subresource
+func (t Target) URLPath() string {
+	if t.IsAPIServer() {
+		return t.Path
+	}
+	name := t.Name
+	if t.Port != "" {
+		name += ":" + t.Port
+	}
+	if t.Scheme != "" && t.Scheme != "http" {
+		name = t.Scheme + ":" + name
+	}
+	return fmt.Sprintf("/api/v1/namespaces/%s/%ss/%s/proxy%s", url.PathEscape(t.Namespace), t.Kind, url.PathEscape(name), t.Path)
+}
+
+// The zero target is the apiserver as well
+func (t Target) IsAPIServer() bool {
+	return t.Kind == APIServer.Kind || t.Kind == ""
+}
+
+func (t Target) String() string {
+	if t.IsAPIServer() {
+		return "apiserver"
+	}
+	target := fmt.Sprintf("%s/%s/%s", t.Kind, t.Namespace, t.Name)
+	if t.Port != "" {
+		target += ":" + t.Port
+	}
+	return target + t.Path
+}
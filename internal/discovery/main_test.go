@@ -0,0 +1,78 @@
+package discovery
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pod(namespace, name string, phase corev1.PodPhase, annotations map[string]string, ports ...int32) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Annotations: annotations},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	container := corev1.Container{Name: "app"}
+	for _, port := range ports {
+		container.Ports = append(container.Ports, corev1.ContainerPort{ContainerPort: port})
+	}
+	p.Spec.Containers = []corev1.Container{container}
+	return p
+}
+
+func TestTargets(t *testing.T) {
+	scrape := map[string]string{scrapeAnnotation: "true"}
+	clientset := fake.NewSimpleClientset(
+		pod("web", "default-port", corev1.PodRunning, scrape, 8080, 9090),
+		pod("web", "annotated", corev1.PodRunning, map[string]string{
+			scrapeAnnotation: "true", schemeAnnotation: "https", portAnnotation: "8443", pathAnnotation: "stats/prometheus",
+		}),
+		pod("web", "pending", corev1.PodPending, scrape, 8080),
+		pod("web", "not-annotated", corev1.PodRunning, nil, 8080),
+		pod("web", "scrape-false", corev1.PodRunning, map[string]string{scrapeAnnotation: "false"}, 8080),
+		pod("other", "elsewhere", corev1.PodRunning, scrape, 8080),
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "frontend", Annotations: scrape},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "backend"}},
+	)
+	d := &Discovery{clientset: clientset}
+
+	targets, err := d.Targets(context.Background(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, target := range targets {
+		names = append(names, target.String())
+	}
+	expected := "pod/web/annotated:8443/stats/prometheus pod/web/default-port:8080/metrics service/web/frontend:80/metrics"
+	if got := strings.Join(names, " "); got != expected {
+		t.Errorf("expected the running annotated pods and services %s, got %s", expected, got)
+	}
+	if path := targets[0].URLPath(); path != "/api/v1/namespaces/web/pods/https:annotated:8443/proxy/stats/prometheus" {
+		t.Errorf("expected the scheme and port in the proxy path, got %s", path)
+	}
+	if path := targets[2].URLPath(); path != "/api/v1/namespaces/web/services/frontend:80/proxy/metrics" {
+		t.Errorf("unexpected proxy path of the service %s", path)
+	}
+
+	if all, err := d.Targets(context.Background(), ""); err != nil || len(all) != 4 {
+		t.Errorf("expected the targets of all namespaces, got %+v %v", all, err)
+	}
+}
+
+func TestAPIServer(t *testing.T) {
+	for _, target := range []Target{APIServer, {}} {
+		if !target.IsAPIServer() || target.String() != "apiserver" {
+			t.Errorf("expected %+v to be the apiserver", target)
+		}
+	}
+	if APIServer.URLPath() != "/metrics" {
+		t.Errorf("unexpected path of the apiserver %s", APIServer.URLPath())
+	}
+}
@@ -0,0 +1,18 @@
+package discovery
+
+import "k8s.io/client-go/kubernetes"
+
+// Endpoint to scrape, either the apiserver itself or a pod or service behind the apiserver proxy
+type Target struct {
+	Kind      string // apiserver, pod or service
+	Namespace string
+	Name      string
+	Scheme    string // http or https
+	Port      string // empty uses the first port of the pod or service
+	Path      string
+}
+
+// Finds the pods and services annotated with prometheus.io/scrape
+type Discovery struct {
+	clientset kubernetes.Interface
+}
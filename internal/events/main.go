@@ -0,0 +1,153 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Pause before trying again after an error, doubled after every failed attempt
+var (
+	minRetry = time.Second // shortened by the tests
+	maxRetry = 30 * time.Second
+)
+
+// Create a watcher for the events of a namespace, all namespaces if it is empty, with one of the reasons
+func New(restConfig *rest.Config, namespace string, reasons []string) (*Watcher, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{clientset: clientset, namespace: namespace, reasons: make(map[string]struct{}, len(reasons))}
+	for _, reason := range reasons {
+		w.reasons[reason] = struct{}{}
+	}
+	return w, nil
+}
+
+// Pass the current events and then the added and updated events to onEvents until the context is done.
+// A closed watch is started again, the events are listed again if the watch has expired. A failed list
+// or watch is retried with a backoff, onError gets the first error after the events were watched.
+func (w *Watcher) Run(ctx context.Context, onEvents func([]Event), onError func(error)) error {
+	resourceVersion := ""
+	backoff := minRetry
+	failing := false
+	for {
+		err := w.watch(ctx, &resourceVersion, onEvents)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			backoff, failing = minRetry, false
+			continue
+		}
+		if !failing {
+			onError(err)
+			failing = true
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, maxRetry)
+	}
+}
+
+// List the events if there is no resource version yet and watch until the watch is closed
+func (w *Watcher) watch(ctx context.Context, resourceVersion *string, onEvents func([]Event)) error {
+	client := w.clientset.CoreV1().Events(w.namespace)
+	if *resourceVersion == "" {
+		list, err := client.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		events := []Event{}
+		for i := range list.Items {
+			if event, ok := w.convert(&list.Items[i]); ok {
+				events = append(events, event)
+			}
+		}
+		onEvents(events)
+		*resourceVersion = list.ResourceVersion
+	}
+
+	watcher, err := client.Watch(ctx, metav1.ListOptions{ResourceVersion: *resourceVersion, AllowWatchBookmarks: true})
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+	for {
+		var result watch.Event
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case result, ok = <-watcher.ResultChan():
+		}
+		if !ok {
+			return nil
+		}
+		switch result.Type {
+		case watch.Added, watch.Modified:
+			if e, ok := result.Object.(*corev1.Event); ok {
+				*resourceVersion = e.ResourceVersion
+				if event, ok := w.convert(e); ok {
+					onEvents([]Event{event})
+				}
+			}
+		case watch.Bookmark:
+			if e, ok := result.Object.(*corev1.Event); ok {
+				*resourceVersion = e.ResourceVersion
+			}
+		case watch.Error:
+			*resourceVersion = "" // list again
+			err := apierrors.FromObject(result.Object)
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Event of the timeline, false if its reason isn't watched
+func (w *Watcher) convert(e *corev1.Event) (Event, bool) {
+	if _, ok := w.reasons[e.Reason]; len(w.reasons) > 0 && !ok {
+		return Event{}, false
+	}
+	return Event{
+		ID:        e.Namespace + "/" + e.Name,
+		Time:      eventTime(e),
+		Type:      e.Type,
+		Namespace: e.Namespace,
+		Object:    e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name,
+		Reason:    e.Reason,
+		Message:   e.Message,
+		Count:     e.Count,
+	}, true
+}
+
+// Time the event last happened, the fields which are set differ between the reporters of events
+func eventTime(e *corev1.Event) time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	case !e.FirstTimestamp.IsZero():
+		return e.FirstTimestamp.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
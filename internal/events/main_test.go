@@ -0,0 +1,169 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newEvent(name, reason string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: name, ResourceVersion: "1"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "web-0"},
+		Reason:         reason,
+		Type:           "Warning",
+		LastTimestamp:  metav1.NewTime(time.Unix(1700000000, 0)),
+		Count:          1,
+	}
+}
+
+// Fake clientset which hands out the watches of the test, counts the lists and fails the first lists
+type fakeCluster struct {
+	*fake.Clientset
+	watches chan *watch.FakeWatcher
+	lists   atomic.Int64
+}
+
+func newFakeCluster(failLists int64, objects ...runtime.Object) *fakeCluster {
+	c := &fakeCluster{Clientset: fake.NewSimpleClientset(objects...), watches: make(chan *watch.FakeWatcher, 10)}
+	c.PrependReactor("list", "events", func(clienttesting.Action) (bool, runtime.Object, error) {
+		if c.lists.Add(1) <= failLists {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	c.PrependWatchReactor("events", func(clienttesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		c.watches <- w
+		return true, w, nil
+	})
+	return c
+}
+
+// Run a watcher in the background, the events and errors are collected
+type run struct {
+	mutex  sync.Mutex
+	events []Event
+	errors []error
+	cancel context.CancelFunc
+	done   chan error
+}
+
+func start(w *Watcher) *run {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &run{cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		r.done <- w.Run(ctx, func(events []Event) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.events = append(r.events, events...)
+		}, func(err error) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.errors = append(r.errors, err)
+		})
+	}()
+	return r
+}
+
+func (r *run) reasons() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	reasons := []string{}
+	for _, event := range r.events {
+		reasons = append(reasons, event.Reason)
+	}
+	return reasons
+}
+
+func (r *run) errorCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.errors)
+}
+
+func (r *run) stop(t *testing.T) {
+	r.cancel()
+	select {
+	case err := <-r.done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the context error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watcher didn't stop")
+	}
+}
+
+func nextWatch(t *testing.T, c *fakeCluster) *watch.FakeWatcher {
+	select {
+	case w := <-c.watches:
+		return w
+	case <-time.After(5 * time.Second):
+		t.Fatal("no watch started")
+		return nil
+	}
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func TestReasonFilter(t *testing.T) {
+	c := newFakeCluster(0, newEvent("a", "BackOff"), newEvent("b", "Pulled"))
+	r := start(&Watcher{clientset: c, namespace: "default", reasons: map[string]struct{}{"BackOff": {}}})
+	defer r.stop(t)
+
+	w := nextWatch(t, c)
+	w.Add(newEvent("c", "Pulled"))
+	w.Modify(newEvent("a", "BackOff"))
+	eventually(t, func() bool { return len(r.reasons()) == 2 })
+	if reasons := r.reasons(); reasons[0] != "BackOff" || reasons[1] != "BackOff" {
+		t.Errorf("expected only the BackOff events, got %v", reasons)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if event := r.events[0]; event.ID != "default/a" || event.Object != "Pod/web-0" || !event.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestRelist(t *testing.T) {
+	defer func(retry time.Duration) { minRetry = retry }(minRetry)
+	minRetry = time.Millisecond
+
+	c := newFakeCluster(1, newEvent("a", "BackOff"))
+	r := start(&Watcher{clientset: c})
+	defer r.stop(t)
+
+	w := nextWatch(t, c) // after the failed first list
+	if c.lists.Load() != 2 || r.errorCount() != 1 {
+		t.Errorf("expected a retried list and one error, got %d lists and %v", c.lists.Load(), r.errors)
+	}
+	w.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired, Message: "too old resource version"})
+	w = nextWatch(t, c)
+	if c.lists.Load() != 3 {
+		t.Errorf("expected the events to be listed again after an expired watch, got %d lists", c.lists.Load())
+	}
+	w.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 500, Reason: metav1.StatusReasonInternalError, Message: "etcd is down"})
+	nextWatch(t, c)
+	if c.lists.Load() != 4 || r.errorCount() != 2 {
+		t.Errorf("expected a list again and the watch error, got %d lists and %v", c.lists.Load(), r.errors)
+	}
+	if reasons := r.reasons(); len(reasons) != 3 {
+		t.Errorf("expected the events of every list, got %v", reasons)
+	}
+}
@@ -0,0 +1,26 @@
+package events
+
+import (
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kubernetes event as shown in the timeline
+type Event struct {
+	ID        string // namespace/name of the event object, an update of an event has the same ID
+	Time      time.Time
+	Type      string // Normal or Warning
+	Namespace string
+	Object    string // kind/name of the involved object
+	Reason    string
+	Message   string
+	Count     int32
+}
+
+// Watches the core/v1 events of a namespace
+type Watcher struct {
+	clientset kubernetes.Interface
+	namespace string
+	reasons   map[string]struct{} // empty keeps all reasons
+}
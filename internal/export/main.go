@@ -0,0 +1,188 @@
+package export
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var Formats = []string{"csv", "json", "markdown", "prometheus"}
+
+var extensions = map[string]string{
+	"csv":        "csv",
+	"json":       "json",
+	"markdown":   "md",
+	"prometheus": "prom",
+}
+
+// File extension for a format
+func Extension(format string) string {
+	return extensions[format]
+}
+
+// Write the rows in one of the formats
+func Write(w io.Writer, format string, rows []Row) error {
+	switch format {
+	case "csv":
+		return writeCSV(w, rows)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jsonRows(rows))
+	case "markdown":
+		return writeMarkdown(w, rows)
+	case "prometheus":
+		return writePrometheus(w, rows)
+	}
+	return fmt.Errorf("unknown export format %q, use one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Escape sequence which makes the terminal copy the content to the clipboard, also over SSH
+func OSC52(content []byte) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString(content) + "\a"
+}
+
+// Columns of the rows: the metric, type, all label keys, the value and the time if there is one
+func header(rows []Row) ([]string, bool) {
+	keys := make(map[string]struct{})
+	timed := false
+	for _, row := range rows {
+		for key, value := range row.Labels {
+			if value != "" {
+				keys[key] = struct{}{}
+			}
+		}
+		timed = timed || !row.Time.IsZero()
+	}
+	labels := make([]string, 0, len(keys))
+	for key := range keys {
+		labels = append(labels, key)
+	}
+	sort.Strings(labels)
+	columns := append([]string{"metric", "type"}, labels...)
+	columns = append(columns, "value")
+	if timed {
+		columns = append(columns, "time")
+	}
+	return columns, timed
+}
+
+func records(rows []Row) [][]string {
+	columns, timed := header(rows)
+	labels := columns[2 : len(columns)-1]
+	if timed {
+		labels = columns[2 : len(columns)-2]
+	}
+	records := [][]string{columns}
+	for _, row := range rows {
+		record := []string{row.Metric, row.Type}
+		for _, key := range labels {
+			record = append(record, row.Labels[key])
+		}
+		record = append(record, row.Value)
+		if timed {
+			record = append(record, row.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func writeCSV(w io.Writer, rows []Row) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(records(rows)); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func writeMarkdown(w io.Writer, rows []Row) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	for i, record := range records(rows) {
+		for j := range record {
+			record[j] = escape.Replace(record[j])
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(record, " | ")); err != nil {
+			return err
+		}
+		if i == 0 {
+			if _, err := fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(record))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Prometheus text format, the value of a histogram or summary is its _sum
+func writePrometheus(w io.Writer, rows []Row) error {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var currentMetric string
+	for _, row := range rows {
+		name, metricType := row.Metric, row.Type
+		if metricType == "histogram" || metricType == "summary" {
+			name, metricType = name+"_sum", "untyped"
+		}
+		if metricType == "" {
+			metricType = "untyped"
+		}
+		if name != currentMetric {
+			if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType); err != nil {
+				return err
+			}
+			currentMetric = name
+		}
+		keys := make([]string, 0, len(row.Labels))
+		for key, value := range row.Labels {
+			if value != "" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		labels := make([]string, 0, len(keys))
+		for _, key := range keys {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, key, escape.Replace(row.Labels[key])))
+		}
+		line := name
+		if len(labels) > 0 {
+			line += "{" + strings.Join(labels, ",") + "}"
+		}
+		line += " " + row.Value
+		if !row.Time.IsZero() {
+			line += " " + strconv.FormatInt(row.Time.UnixMilli(), 10)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Without empty labels and zero times
+func jsonRows(rows []Row) []interface{} {
+	out := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		labels := make(map[string]string, len(row.Labels))
+		for key, value := range row.Labels {
+			if value != "" {
+				labels[key] = value
+			}
+		}
+		object := map[string]interface{}{
+			"metric": row.Metric,
+			"type":   row.Type,
+			"labels": labels,
+			"value":  row.Value,
+		}
+		if !row.Time.IsZero() {
+			object["time"] = row.Time
+		}
+		out = append(out, object)
+	}
+	return out
+}
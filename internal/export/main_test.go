@@ -0,0 +1,130 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+const samplePage = `# TYPE apiserver_current_inflight_requests gauge
+apiserver_current_inflight_requests{request_kind="mutating"} 3
+apiserver_current_inflight_requests{request_kind="readOnly"} 12
+# TYPE apiserver_request_total counter
+apiserver_request_total{path="/a,b|c",note="say \"hi\"\\now"} 42
+`
+
+// Rows of the series of a parsed page, like the rows of a view
+func parseRows(t *testing.T, page string) []Row {
+	data := realtimedata.RealTimeData{}
+	data.NextGeneration()
+	if err := data.Parse(strings.NewReader(page), nil); err != nil {
+		t.Fatal(err)
+	}
+	rows := []Row{}
+	for _, metric := range data.Metrics {
+		for _, value := range metric.Values {
+			labels := make(map[string]string, len(value.Labels))
+			for _, label := range value.Labels {
+				labels[label.Label] = label.Value
+			}
+			rows = append(rows, Row{Metric: metric.Name, Type: metric.Type, Labels: labels, Value: value.Value})
+		}
+	}
+	return rows
+}
+
+func write(t *testing.T, format string, rows []Row) string {
+	var b bytes.Buffer
+	if err := Write(&b, format, rows); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestCSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(write(t, "csv", parseRows(t, samplePage)))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(records[0], ","); got != "metric,type,note,path,request_kind,value" {
+		t.Errorf("unexpected header %s", got)
+	}
+	if len(records) != 4 || records[3][2] != `say "hi"\now` || records[3][3] != "/a,b|c" || records[3][5] != "42" {
+		t.Errorf("expected the quoted labels to be read back, got %q", records)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var rows []struct {
+		Metric string            `json:"metric"`
+		Labels map[string]string `json:"labels"`
+		Value  string            `json:"value"`
+		Time   *time.Time        `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(write(t, "json", parseRows(t, samplePage))), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[2].Labels["note"] != `say "hi"\now` || len(rows[0].Labels) != 1 || rows[0].Time != nil {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+	timed := []Row{{Metric: "up", Value: "1", Time: time.Unix(1700000000, 0)}}
+	if err := json.Unmarshal([]byte(write(t, "json", timed)), &rows); err != nil || rows[0].Time == nil || rows[0].Time.Unix() != 1700000000 {
+		t.Errorf("expected the time of a sample, got %+v %v", rows, err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(write(t, "markdown", parseRows(t, samplePage))), "\n")
+	expected := []string{
+		"| metric | type | note | path | request_kind | value |",
+		"| --- | --- | --- | --- | --- | --- |",
+		"| apiserver_current_inflight_requests | gauge |  |  | mutating | 3 |",
+		"| apiserver_current_inflight_requests | gauge |  |  | readOnly | 12 |",
+		`| apiserver_request_total | counter | say "hi"\now | /a,b\|c |  | 42 |`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected table:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	rows := parseRows(t, samplePage)
+	text := write(t, "prometheus", rows)
+	if !strings.Contains(text, `apiserver_request_total{note="say \"hi\"\\now",path="/a,b|c"} 42`) {
+		t.Errorf("expected the labels to be escaped:\n%s", text)
+	}
+	// the export is a page again
+	if write(t, "csv", parseRows(t, text)) != write(t, "csv", rows) {
+		t.Errorf("expected the same series after parsing the export:\n%s", text)
+	}
+
+	timed := write(t, "prometheus", []Row{{Metric: "wait", Type: "histogram", Value: "1.5", Time: time.UnixMilli(1700000000123)}})
+	if timed != "# TYPE wait_sum untyped\nwait_sum 1.5 1700000000123\n" {
+		t.Errorf("expected the _sum of a histogram with the time, got %q", timed)
+	}
+}
+
+func TestOSC52(t *testing.T) {
+	content := []byte("a,b\n\"c\"\n")
+	sequence := OSC52(content)
+	encoded, ok := strings.CutPrefix(sequence, "\x1b]52;c;")
+	if !ok || !strings.HasSuffix(encoded, "\a") {
+		t.Fatalf("unexpected sequence %q", sequence)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(encoded, "\a"))
+	if err != nil || !bytes.Equal(decoded, content) {
+		t.Errorf("expected the content base64 encoded, got %q %v", decoded, err)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "xml", nil); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,12 @@
+package export
+
+import "time"
+
+// A series in the current view, or a sample of a series with its time
+type Row struct {
+	Metric string
+	Type   string
+	Labels map[string]string
+	Value  string
+	Time   time.Time // zero for the current value
+}
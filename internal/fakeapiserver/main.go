@@ -0,0 +1,38 @@
+package fakeapiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+const defaultToken = "fake-token"
+
+// Start a server which serves a page of the function on /metrics and on the /metrics of the proxy
+// subresource of pods and services. Close the server when done.
+func New(page func() []byte) *Server {
+	s := &Server{Token: defaultToken, page: page}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.Token {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path != "/metrics" && !strings.HasSuffix(r.URL.Path, "/proxy/metrics") {
+		http.NotFound(w, r)
+		return
+	}
+	s.Scrapes.Add(1)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(s.page())
+}
+
+// Config to connect to the server like with a kubeconfig
+func (s *Server) RestConfig() *rest.Config {
+	return &rest.Config{Host: s.URL, BearerToken: s.Token}
+}
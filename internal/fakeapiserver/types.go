@@ -0,0 +1,14 @@
+package fakeapiserver
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+)
+
+// Apiserver which only serves metrics, for tests and to try the scraper without a cluster
+type Server struct {
+	*httptest.Server
+	Token   string       // bearer token the requests must have
+	Scrapes atomic.Int64 // number of served metrics pages
+	page    func() []byte
+}
@@ -0,0 +1,384 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+const (
+	tokenWord = iota
+	tokenOperator
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenOpen
+	tokenClose
+)
+
+// Operators ordered so two character operators are matched first
+var operators = []string{"=~", "!~", "!=", ">=", "<=", "=", ">", "<", ":"}
+
+// Compile a filter, the structured syntax is tried first and a plain regex is the fallback.
+// A filter without comparisons or operators is one regex, so groups and spaces are part of it.
+// An empty filter returns a nil Expression which matches everything.
+func Compile(text string) (Expression, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenize(text)
+	if err == nil && structured(tokens) {
+		var expression Expression
+		if expression, err = Parse(text); err == nil {
+			return expression, nil
+		}
+	}
+	regex, regexErr := regexp.Compile(text)
+	if regexErr != nil {
+		if err == nil {
+			err = regexErr
+		}
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	return &regexExpression{regex: regex}, nil
+}
+
+// Parse the structured filter syntax:
+//
+//	label=value label!=value label=~regex label!~regex
+//	value>10 value<=0.5 value=0
+//	type:counter
+//	!term (term) term AND term, term OR term, term && term, term || term
+//
+// Terms without an operator are matched as regex against name, labels and value.
+// Terms next to each other are combined with AND. The lowercase and, or are only
+// operators between comparisons like verb=GET or code=500, elsewhere these are regex terms.
+func Parse(text string) (Expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens}
+	expression, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return expression, nil
+}
+
+// Match a series, a nil expression matches everything
+func Match(expression Expression, metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	if expression == nil {
+		return true
+	}
+	return expression.Match(metric, value)
+}
+
+func tokenize(text string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")"})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			unquoted, err := strconv.Unquote(string(runes[i : end+1]))
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: unquoted})
+			i = end + 1
+		default:
+			if op := operatorAt(runes, i); op != "" {
+				tokens = append(tokens, token{kind: tokenOperator, text: op})
+				i += len(op)
+				continue
+			}
+			if r == '!' {
+				tokens = append(tokens, token{kind: tokenNot, text: "!"})
+				i++
+				continue
+			}
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()\"!=<>:", runes[end]) {
+				end++
+			}
+			// regex operators like ! are allowed inside a word
+			for end < len(runes) && runes[end] == '!' && operatorAt(runes, end) == "" {
+				end++
+				for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()\"!=<>:", runes[end]) {
+					end++
+				}
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "AND", "&&":
+				tokens = append(tokens, token{kind: tokenAnd, text: word})
+			case "OR", "||":
+				tokens = append(tokens, token{kind: tokenOr, text: word})
+			default:
+				tokens = append(tokens, token{kind: tokenWord, text: word})
+			}
+			i = end
+		}
+	}
+	// lowercase and/or are words of a regex unless these are between complete comparisons
+	for i, t := range tokens {
+		if t.kind == tokenWord && (t.text == "and" || t.text == "or") && endsComparison(tokens[:i]) && startsComparison(tokens[i+1:]) {
+			tokens[i].kind = tokenAnd
+			if t.text == "or" {
+				tokens[i].kind = tokenOr
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// The tokens have a comparison or an operator, otherwise the text is a plain regex
+func structured(tokens []token) bool {
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenOperator, tokenAnd, tokenOr, tokenNot:
+			return true
+		}
+	}
+	return false
+}
+
+// The tokens end with a comparison like label=value or a group
+func endsComparison(tokens []token) bool {
+	n := len(tokens)
+	if n > 0 && tokens[n-1].kind == tokenClose {
+		return true
+	}
+	return n >= 3 && tokens[n-3].kind == tokenWord && tokens[n-2].kind == tokenOperator && tokens[n-1].kind == tokenWord
+}
+
+// The tokens start with a comparison, a negation or a group
+func startsComparison(tokens []token) bool {
+	if len(tokens) > 0 && (tokens[0].kind == tokenOpen || tokens[0].kind == tokenNot) {
+		return true
+	}
+	return len(tokens) >= 2 && tokens[0].kind == tokenWord && tokens[1].kind == tokenOperator
+}
+
+func operatorAt(runes []rune, i int) string {
+	for _, op := range operators {
+		if strings.HasPrefix(string(runes[i:min(i+2, len(runes))]), op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokenOr; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpression{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind != tokenOr && t.kind != tokenClose; t = p.peek() {
+		if t.kind == tokenAnd {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpression{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	switch t.kind {
+	case tokenNot:
+		p.pos++
+		expression, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpression{expression: expression}, nil
+	case tokenOpen:
+		p.pos++
+		expression, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != tokenClose {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return expression, nil
+	case tokenWord:
+		p.pos++
+		if op := p.peek(); op != nil && op.kind == tokenOperator {
+			p.pos++
+			value := p.peek()
+			if value == nil || value.kind != tokenWord {
+				return nil, fmt.Errorf("missing value after %s%s", t.text, op.text)
+			}
+			p.pos++
+			return newMatcher(t.text, op.text, value.text)
+		}
+		regex, err := regexp.Compile(t.text)
+		if err != nil {
+			return nil, err
+		}
+		return &regexExpression{regex: regex}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+func newMatcher(key string, operator string, value string) (Expression, error) {
+	if operator == ":" {
+		if key != "type" {
+			return nil, fmt.Errorf("unknown key %s:", key)
+		}
+		return &typeExpression{metricType: value}, nil
+	}
+	if key == "value" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil && operator != "=~" && operator != "!~" {
+			return &valueExpression{operator: operator, value: f}, nil
+		}
+		if operator != "=" && operator != "!=" && operator != "=~" && operator != "!~" {
+			return nil, fmt.Errorf("value%s needs a number: %s", operator, value)
+		}
+	}
+	switch operator {
+	case "=", "!=":
+		return &labelExpression{label: key, operator: operator, value: value}, nil
+	case "=~", "!~":
+		regex, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return &labelExpression{label: key, operator: operator, value: value, regex: regex}, nil
+	}
+	return nil, fmt.Errorf("operator %s is not supported for label %s", operator, key)
+}
+
+func (e *andExpression) Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	return e.left.Match(metric, value) && e.right.Match(metric, value)
+}
+
+func (e *orExpression) Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	return e.left.Match(metric, value) || e.right.Match(metric, value)
+}
+
+func (e *notExpression) Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	return !e.expression.Match(metric, value)
+}
+
+func (e *regexExpression) Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	if e.regex.MatchString(metric.Name) || e.regex.MatchString(value.Value) {
+		return true
+	}
+	for _, label := range value.Labels {
+		if e.regex.MatchString(label.Label) || e.regex.MatchString(label.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *labelExpression) Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	labelValue := ""
+	if e.label == "__name__" {
+		labelValue = metric.Name
+	}
+	for _, label := range value.Labels {
+		if label.Label == e.label {
+			labelValue = label.Value
+			break
+		}
+	}
+	switch e.operator {
+	case "=":
+		return labelValue == e.value
+	case "!=":
+		return labelValue != e.value
+	case "=~":
+		return e.regex.MatchString(labelValue)
+	case "!~":
+		return !e.regex.MatchString(labelValue)
+	}
+	return false
+}
+
+func (e *valueExpression) Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	f, err := strconv.ParseFloat(value.Value, 64)
+	if err != nil {
+		return false
+	}
+	switch e.operator {
+	case ">":
+		return f > e.value
+	case ">=":
+		return f >= e.value
+	case "<":
+		return f < e.value
+	case "<=":
+		return f <= e.value
+	case "=":
+		return f == e.value
+	case "!=":
+		return f != e.value
+	}
+	return false
+}
+
+func (e *typeExpression) Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool {
+	return strings.EqualFold(metric.Type, e.metricType)
+}
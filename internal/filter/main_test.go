@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+var (
+	testMetric = &realtimedata.RealTimeDataMetric{Name: "apiserver_request_total", Type: "counter"}
+	testValue  = &realtimedata.RealTimeDataMetricValue{
+		Labels: []realtimedata.RealTimeDataMetricLabel{
+			{Label: "code", Value: "200"},
+			{Label: "path", Value: "/a b"},
+			{Label: "resource", Value: "pods"},
+			{Label: "verb", Value: "GET"},
+		},
+		Value: "42",
+	}
+)
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		filter  string
+		matches bool
+	}{
+		{"", true},
+		{"verb=GET", true},
+		{"verb!=GET", false},
+		{"verb=~G.*", true},
+		{"verb!~G.*", false},
+		{"verb=~ET", false}, // anchored
+		{"__name__=apiserver_request_total", true},
+		{`missing=""`, true},
+		{"value>10", true},
+		{"value <= 10", false},
+		{"value=42", true},
+		{"type:counter", true},
+		{"type:gauge", false},
+		{"verb=GET code=500", false},
+		{"verb=POST OR code=200", true},
+		{"verb=POST || code=200", true},
+		{"verb=GET && code=500", false},
+		{"verb=POST or code=200", true},
+		{"verb=POST and code=200", false},
+		{"verb=POST AND code=500 OR resource=pods", true}, // AND binds stronger than OR
+		{"verb=POST AND (code=500 OR resource=pods)", false},
+		{"(verb=POST) or !code=500", true},
+		{"!verb=GET", false},
+		{"!(verb=POST OR code=500)", true},
+		{`path="/a b"`, true},
+		{`path="/a \"b\""`, false},
+		{"request_total", true},
+		{"request_total pods", false}, // one regex with a space
+		{"^(GET|LIST)$", true},
+		{"^(GE|LIST)$", false}, // anchored group, not ^ AND GE|LIST AND $
+		{"(pods|nodes)", true},
+		{"^/a b$", true},
+		{"a (c|d)$", false},
+		{"request_total nodes", false},
+		{"^apiserver_.*_total$", true},
+		{"pods or nodes", false}, // regex terms, "or" is one of them
+		{"GET|POST", true},
+		{"value>abc", false}, // not a number, so a plain regex
+	} {
+		expression, err := Compile(test.filter)
+		if err != nil {
+			t.Errorf("%q: %v", test.filter, err)
+			continue
+		}
+		if got := Match(expression, testMetric, testValue); got != test.matches {
+			t.Errorf("%q: expected %v, got %v", test.filter, test.matches, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		filter string
+		want   string // type of the expression, empty for an error
+	}{
+		{"verb=GET or code=200", "*filter.orExpression"},
+		{"verb=GET and code=200", "*filter.andExpression"},
+		{"(verb=GET) or !code=200", "*filter.orExpression"},
+		{"error or warning", "*filter.andExpression"},
+		{"verb=GET or", "*filter.andExpression"},
+		{"or verb=GET", "*filter.andExpression"},
+		{"verb=", ""},
+		{"(verb=GET", ""},
+		{"verb=GET)", ""},
+		{`path="/a`, ""},
+		{"value>abc", ""},
+		{"foo:bar", ""},
+		{"verb=~(", ""},
+		{"OR verb=GET", ""},
+		{"!", ""},
+	} {
+		expression, err := Parse(test.filter)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %T", test.filter, expression)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.filter, err)
+		} else if got := fmt.Sprintf("%T", expression); got != test.want {
+			t.Errorf("%q: expected %s, got %s", test.filter, test.want, got)
+		}
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, filter := range []string{"(", "a[", "verb=~("} {
+		if _, err := Compile(filter); err == nil {
+			t.Errorf("%q: expected an error", filter)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package filter
+
+import (
+	"regexp"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// Expression matches a single series of a metric
+type Expression interface {
+	Match(metric *realtimedata.RealTimeDataMetric, value *realtimedata.RealTimeDataMetricValue) bool
+}
+
+type andExpression struct {
+	left, right Expression
+}
+
+type orExpression struct {
+	left, right Expression
+}
+
+type notExpression struct {
+	expression Expression
+}
+
+// Plain regex matched against the name, labels and value (the original filter behaviour)
+type regexExpression struct {
+	regex *regexp.Regexp
+}
+
+type labelExpression struct {
+	label    string
+	operator string
+	value    string
+	regex    *regexp.Regexp
+}
+
+type valueExpression struct {
+	operator string
+	value    float64
+}
+
+type typeExpression struct {
+	metricType string
+}
+
+type token struct {
+	kind int
+	text string
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
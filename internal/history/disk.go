@@ -0,0 +1,408 @@
+package history
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/sirupsen/logrus"
+)
+
+// A block is a sequence of frames: a series frame gives a series id a number in the block,
+// a scrape frame has a time and the values of the series by number.
+const (
+	seriesFrame byte = 1
+	scrapeFrame byte = 2
+
+	blockHour = "2006010215" // blocks are named after their hour in UTC
+	rawBlock  = ".raw"
+	downBlock = ".down" // downsampled
+)
+
+// Open the history in a directory, the blocks of an earlier run are kept
+func OpenDisk(dir string, options DiskOptions) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	d := &Disk{dir: dir, options: options}
+	if err := d.maintain(time.Now()); err != nil {
+		logrus.Warnf("Unable to clean up history in %s: %v", dir, err)
+	}
+	return d, nil
+}
+
+func (d *Disk) Append(data realtimedata.RealTimeData) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if block := data.Time.UTC().Format(blockHour); block != d.block {
+		if err := d.rotate(block); err != nil {
+			return err
+		}
+		if err := d.maintain(data.Time); err != nil {
+			logrus.Warnf("Unable to clean up history in %s: %v", d.dir, err)
+		}
+	}
+	if d.writer == nil {
+		return fmt.Errorf("no history block open in %s", d.dir)
+	}
+
+	var scrape []byte
+	count := 0
+	for _, metric := range data.Metrics {
+		for _, value := range metric.Values {
+			if value.LastSeen != data.Generation {
+				continue
+			}
+			v, err := strconv.ParseFloat(value.Value, 64)
+			if err != nil {
+				continue
+			}
+			id := realtimedata.SeriesID(metric.Name, value.Hash)
+			number, ok := d.numbers[id]
+			if !ok {
+				number = uint64(len(d.numbers))
+				d.numbers[id] = number
+				if err := d.writeSeries(number, id); err != nil {
+					return err
+				}
+			}
+			scrape = binary.AppendUvarint(scrape, number)
+			scrape = binary.LittleEndian.AppendUint64(scrape, math.Float64bits(v))
+			count++
+		}
+	}
+	frame := []byte{scrapeFrame}
+	frame = binary.AppendVarint(frame, data.Time.UnixMilli())
+	frame = binary.AppendUvarint(frame, uint64(count))
+	if _, err := d.writer.Write(append(frame, scrape...)); err != nil {
+		return err
+	}
+	return d.writer.Flush()
+}
+
+func (d *Disk) writeSeries(number uint64, id string) error {
+	frame := []byte{seriesFrame}
+	frame = binary.AppendUvarint(frame, number)
+	frame = binary.AppendUvarint(frame, uint64(len(id)))
+	_, err := d.writer.Write(append(frame, id...))
+	return err
+}
+
+// Switch to the block of another hour, appending to it if it exists.
+// The block is only set once it is open, so a failed rotation is tried again with the next scrape.
+func (d *Disk) rotate(block string) error {
+	if d.file != nil {
+		d.file.Close()
+	}
+	d.block, d.file, d.writer, d.numbers = "", nil, nil, nil
+	path := filepath.Join(d.dir, block+rawBlock)
+
+	numbers := make(map[string]uint64)
+	size, err := readBlock(path, func(id string, number uint64) { numbers[id] = number }, nil)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	// drop a frame which was written partly when the viewer stopped
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	d.block, d.file, d.writer, d.numbers = block, file, bufio.NewWriter(file), numbers
+	return nil
+}
+
+// Remove the blocks after the retention and downsample the older raw blocks
+func (d *Disk) maintain(now time.Time) error {
+	blocks, err := d.blocks()
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		hour, err := time.Parse(blockHour, blockName(block))
+		if err != nil {
+			continue
+		}
+		end := hour.Add(time.Hour)
+		path := filepath.Join(d.dir, block)
+		switch {
+		case d.options.Retention > 0 && now.Sub(end) > d.options.Retention:
+			logrus.Debugf("Removing history block %s", path)
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		case strings.HasSuffix(block, rawBlock) && blockName(block) != d.block &&
+			d.options.DownsampleAfter > 0 && now.Sub(end) > d.options.DownsampleAfter:
+			logrus.Debugf("Downsampling history block %s", path)
+			if err := d.downsample(block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Replace a raw block by a block with the average of every series per downsample interval
+func (d *Disk) downsample(block string) error {
+	interval := d.options.DownsampleInterval.Milliseconds()
+	if interval <= 0 {
+		interval = time.Minute.Milliseconds()
+	}
+	buckets := make(map[int64]map[string]*sum)
+	_, err := readBlock(filepath.Join(d.dir, block), nil, func(id string, sample Sample) {
+		bucket := sample.Time.UnixMilli() / interval * interval
+		if buckets[bucket] == nil {
+			buckets[bucket] = make(map[string]*sum)
+		}
+		s, ok := buckets[bucket][id]
+		if !ok {
+			s = &sum{}
+			buckets[bucket][id] = s
+		}
+		s.total += sample.Value
+		s.count++
+	})
+	if err != nil {
+		return err
+	}
+
+	times := make([]int64, 0, len(buckets))
+	for t := range buckets {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	name := blockName(block)
+	tmp := filepath.Join(d.dir, name+downBlock+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := writeDownsampled(file, buckets, times); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(d.dir, name+downBlock)); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(d.dir, block))
+}
+
+// Write the averages of a downsampled block, oldest interval first
+func writeDownsampled(file *os.File, buckets map[int64]map[string]*sum, times []int64) error {
+	writer := bufio.NewWriter(file)
+	numbers := make(map[string]uint64)
+	for _, t := range times {
+		ids := make([]string, 0, len(buckets[t]))
+		for id := range buckets[t] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		frame := []byte{scrapeFrame}
+		frame = binary.AppendVarint(frame, t)
+		frame = binary.AppendUvarint(frame, uint64(len(ids)))
+		for _, id := range ids {
+			number, ok := numbers[id]
+			if !ok {
+				number = uint64(len(numbers))
+				numbers[id] = number
+				series := []byte{seriesFrame}
+				series = binary.AppendUvarint(series, number)
+				series = binary.AppendUvarint(series, uint64(len(id)))
+				if _, err := writer.Write(append(series, id...)); err != nil {
+					return err
+				}
+			}
+			s := buckets[t][id]
+			frame = binary.AppendUvarint(frame, number)
+			frame = binary.LittleEndian.AppendUint64(frame, math.Float64bits(s.total/float64(s.count)))
+		}
+		if _, err := writer.Write(frame); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// All samples of a series over the blocks. The blocks are read without the lock so the scrapes
+// aren't held up, a partly written frame at the end of the current block is skipped.
+func (d *Disk) Series(id string) ([]Sample, error) {
+	d.mutex.Lock()
+	blocks, err := d.blocks()
+	d.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	samples := []Sample{}
+	collect := func(seriesID string, sample Sample) {
+		if seriesID == id {
+			samples = append(samples, sample)
+		}
+	}
+	for _, block := range blocks {
+		_, err := readBlock(filepath.Join(d.dir, block), nil, collect)
+		if errors.Is(err, os.ErrNotExist) && strings.HasSuffix(block, rawBlock) {
+			// downsampled since the blocks were listed
+			_, err = readBlock(filepath.Join(d.dir, blockName(block)+downBlock), nil, collect)
+		}
+		if errors.Is(err, os.ErrNotExist) { // removed after the retention
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no history for series %s", id)
+	}
+	return samples, nil
+}
+
+func (d *Disk) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file, d.block = nil, ""
+	return err
+}
+
+// Block files ordered by time, a raw block is skipped if it has already been downsampled
+func (d *Disk) blocks() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	downsampled := make(map[string]bool)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), downBlock) {
+			downsampled[blockName(entry.Name())] = true
+		}
+	}
+	blocks := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, downBlock) || (strings.HasSuffix(name, rawBlock) && !downsampled[blockName(name)]) {
+			blocks = append(blocks, name)
+		}
+	}
+	sort.Strings(blocks)
+	return blocks, nil
+}
+
+func blockName(file string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(file, rawBlock), downBlock)
+}
+
+// Read the frames of a block, returns the size of the complete frames.
+// A partly written frame at the end isn't an error.
+func readBlock(path string, series func(id string, number uint64), sample func(id string, sample Sample)) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := &countingReader{reader: bufio.NewReader(file)}
+	ids := []string{}
+	var valid int64
+	for {
+		kind, err := reader.ReadByte()
+		if err == io.EOF {
+			return valid, nil
+		}
+		if err != nil {
+			return valid, err
+		}
+		switch kind {
+		case seriesFrame:
+			number, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return valid, nil
+			}
+			length, err := binary.ReadUvarint(reader)
+			if err != nil || length > 64*1024 {
+				return valid, nil
+			}
+			id := make([]byte, length)
+			if _, err := io.ReadFull(reader, id); err != nil {
+				return valid, nil
+			}
+			for uint64(len(ids)) <= number {
+				ids = append(ids, "")
+			}
+			ids[number] = string(id)
+			if series != nil {
+				series(string(id), number)
+			}
+		case scrapeFrame:
+			ms, err := binary.ReadVarint(reader)
+			if err != nil {
+				return valid, nil
+			}
+			count, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return valid, nil
+			}
+			t := time.UnixMilli(ms)
+			var value [8]byte
+			for i := uint64(0); i < count; i++ {
+				number, err := binary.ReadUvarint(reader)
+				if err != nil {
+					return valid, nil
+				}
+				if _, err := io.ReadFull(reader, value[:]); err != nil {
+					return valid, nil
+				}
+				if sample != nil && number < uint64(len(ids)) {
+					sample(ids[number], Sample{Time: t, Value: math.Float64frombits(binary.LittleEndian.Uint64(value[:]))})
+				}
+			}
+		default:
+			return valid, nil // garbage after an incomplete frame
+		}
+		valid = reader.count
+	}
+}
+
+type countingReader struct {
+	reader *bufio.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.count++
+	}
+	return b, err
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// Number of samples kept per series in memory, 10 minutes with the default scrape interval
+const DefaultSize = 600
+
+func NewMemory(size int) *Memory {
+	if size < 1 {
+		size = DefaultSize
+	}
+	return &Memory{size: size, series: make(map[string]*ring)}
+}
+
+// Add the values of the last scrape, series which weren't scraped for a full buffer are dropped
+func (m *Memory) Append(data realtimedata.RealTimeData) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.generation++
+	for _, metric := range data.Metrics {
+		for _, value := range metric.Values {
+			if value.LastSeen != data.Generation {
+				continue
+			}
+			v, err := strconv.ParseFloat(value.Value, 64)
+			if err != nil {
+				continue
+			}
+			id := realtimedata.SeriesID(metric.Name, value.Hash)
+			r, ok := m.series[id]
+			if !ok {
+				r = &ring{}
+				m.series[id] = r
+			}
+			r.add(Sample{Time: data.Time, Value: v}, m.size)
+			r.lastSeen = m.generation
+		}
+	}
+	for id, r := range m.series {
+		if m.generation-r.lastSeen >= m.size {
+			delete(m.series, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Series(id string) ([]Sample, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	r, ok := m.series[id]
+	if !ok {
+		return nil, fmt.Errorf("no history for series %s", id)
+	}
+	return r.ordered(), nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (r *ring) add(sample Sample, size int) {
+	if len(r.samples) < size {
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % size
+}
+
+func (r *ring) ordered() []Sample {
+	samples := make([]Sample, 0, len(r.samples))
+	samples = append(samples, r.samples[r.next:]...)
+	return append(samples, r.samples[:r.next]...)
+}
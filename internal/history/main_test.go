@@ -0,0 +1,194 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// Scrapes of one gauge, the id is the series id of the gauge
+type scrapes struct {
+	data realtimedata.RealTimeData
+	id   string
+}
+
+func (s *scrapes) next(t *testing.T, at time.Time, value string) realtimedata.RealTimeData {
+	s.data.NextGeneration()
+	page := "# TYPE apiserver_current_inflight_requests gauge\napiserver_current_inflight_requests{request_kind=\"mutating\"} " + value + "\n"
+	if err := s.data.Parse(strings.NewReader(page), nil); err != nil {
+		t.Fatal(err)
+	}
+	s.data.Time = at
+	m := s.data.Metrics[0]
+	s.id = realtimedata.SeriesID(m.Name, m.Values[0].Hash)
+	return s.data.Snapshot()
+}
+
+func values(samples []Sample) []float64 {
+	v := make([]float64, len(samples))
+	for i, s := range samples {
+		v[i] = s.Value
+	}
+	return v
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiskPartialFrame(t *testing.T) {
+	dir := t.TempDir()
+	hour := time.Now().UTC().Truncate(time.Hour)
+	s := &scrapes{}
+	d, err := OpenDisk(dir, DiskOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range []string{"1", "2"} {
+		if err := d.Append(s.next(t, hour.Add(time.Duration(i)*time.Second), value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	// a scrape frame which was cut off when the viewer stopped
+	path := filepath.Join(dir, hour.Format(blockHour)+rawBlock)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{scrapeFrame, 0x80})
+	file.Close()
+
+	d, err = OpenDisk(dir, DiskOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Append(s.next(t, hour.Add(2*time.Second), "3")); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := d.Series(s.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(values(samples), []float64{1, 2, 3}) || !samples[2].Time.Equal(hour.Add(2*time.Second)) {
+		t.Errorf("expected the partial frame to be dropped, got %+v", samples)
+	}
+}
+
+func TestDiskFailedRotation(t *testing.T) {
+	dir := t.TempDir()
+	hour := time.Now().UTC().Truncate(time.Hour)
+	s := &scrapes{}
+	d, err := OpenDisk(dir, DiskOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	// a directory in place of the block can't be opened
+	path := filepath.Join(dir, hour.Format(blockHour)+rawBlock)
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.Append(s.next(t, hour.Add(time.Duration(i)*time.Second), "1")); err == nil {
+			t.Fatalf("append %d: expected an error without a block", i+1)
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Append(s.next(t, hour.Add(2*time.Second), "2")); err != nil {
+		t.Fatalf("expected the block to be opened again, got %v", err)
+	}
+	if samples, err := d.Series(s.id); err != nil || !equal(values(samples), []float64{2}) {
+		t.Errorf("expected the scrape after the failed rotations, got %+v %v", samples, err)
+	}
+}
+
+func TestDiskDownsample(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Hour)
+	old := now.Add(-3 * time.Hour)
+	s := &scrapes{}
+	d, err := OpenDisk(dir, DiskOptions{DownsampleAfter: time.Hour, DownsampleInterval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, scrape := range []struct {
+		at    time.Duration
+		value string
+	}{{0, "1"}, {30 * time.Second, "3"}, {time.Minute, "5"}, {90 * time.Second, "6"}} {
+		if err := d.Append(s.next(t, old.Add(scrape.at), scrape.value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Append(s.next(t, now, "7")); err != nil { // rotates and downsamples the old block
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, old.Format(blockHour)+downBlock)); err != nil {
+		t.Fatalf("expected a downsampled block: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, old.Format(blockHour)+rawBlock)); !os.IsNotExist(err) {
+		t.Errorf("expected the raw block to be removed, got %v", err)
+	}
+	samples, err := d.Series(s.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(values(samples), []float64{2, 5.5, 7}) || !samples[1].Time.Equal(old.Add(time.Minute)) {
+		t.Errorf("expected the averages per minute, got %+v", samples)
+	}
+
+	// a raw block left next to its downsampled block isn't read twice
+	down, _ := os.ReadFile(filepath.Join(dir, old.Format(blockHour)+downBlock))
+	os.WriteFile(filepath.Join(dir, old.Format(blockHour)+rawBlock), down, 0600)
+	blocks, err := d.blocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0] != old.Format(blockHour)+downBlock {
+		t.Errorf("expected the downsampled and the current block, got %v", blocks)
+	}
+}
+
+func TestDiskRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Hour)
+	s := &scrapes{}
+	d, err := OpenDisk(dir, DiskOptions{Retention: 2 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, at := range []time.Time{now.Add(-5 * time.Hour), now.Add(-2 * time.Hour), now} {
+		if err := d.Append(s.next(t, at, "1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, now.Add(-5*time.Hour).Format(blockHour)+rawBlock)); !os.IsNotExist(err) {
+		t.Errorf("expected the block after the retention to be removed, got %v", err)
+	}
+	samples, err := d.Series(s.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Errorf("expected the samples of the last 2 blocks, got %+v", samples)
+	}
+}
@@ -0,0 +1,61 @@
+package history
+
+import (
+	"bufio"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Keeps the values of the scraped series over time
+type Store interface {
+	Append(data realtimedata.RealTimeData) error
+	Series(id string) ([]Sample, error) // oldest sample first
+	Close() error
+}
+
+// Store with the last samples of every series in memory
+type Memory struct {
+	mutex      sync.Mutex
+	size       int
+	generation int
+	series     map[string]*ring
+}
+
+// Store which writes every sample to hourly blocks in a directory,
+// older blocks are downsampled and removed after the retention
+type Disk struct {
+	mutex   sync.Mutex
+	dir     string
+	options DiskOptions
+	block   string // hour of the block which is written
+	file    *os.File
+	writer  *bufio.Writer
+	numbers map[string]uint64 // series id -> number in the written block
+}
+
+type DiskOptions struct {
+	Retention          time.Duration // 0 keeps all blocks
+	DownsampleAfter    time.Duration // 0 never downsamples
+	DownsampleInterval time.Duration
+}
+
+// Total of the samples of a series in an interval of a downsampled block
+type sum struct {
+	total float64
+	count int
+}
+
+// Fixed size buffer, next is the position of the oldest sample once the buffer is full
+type ring struct {
+	samples  []Sample
+	next     int
+	lastSeen int // generation of the last append
+}
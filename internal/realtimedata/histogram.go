@@ -0,0 +1,69 @@
+package realtimedata
+
+import (
+	"math"
+	"sort"
+)
+
+// Quantile of cumulative histogram buckets with linear interpolation, like histogram_quantile in PromQL.
+// Returns NaN if the buckets have no observations or no +Inf bucket.
+func Quantile(q float64, buckets []RealTimeDataBucket) float64 {
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].UpperBound, 1) {
+		return math.NaN()
+	}
+	observations := buckets[len(buckets)-1].Count
+	if observations == 0 {
+		return math.NaN()
+	}
+	rank := q * observations
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].Count >= rank })
+	if b == len(buckets)-1 {
+		return buckets[len(buckets)-2].UpperBound
+	}
+	if b == 0 && buckets[0].UpperBound <= 0 {
+		return buckets[0].UpperBound
+	}
+	bucketStart := 0.0
+	bucketEnd := buckets[b].UpperBound
+	count := buckets[b].Count
+	if b > 0 {
+		bucketStart = buckets[b-1].UpperBound
+		count -= buckets[b-1].Count
+		rank -= buckets[b-1].Count
+	}
+	return bucketStart + (bucketEnd-bucketStart)*(rank/count)
+}
+
+// Observations between two scrapes, the current buckets are returned after a counter reset.
+// A reset is seen by a bucket which went down or by deltas which aren't cumulative anymore.
+func DeltaBuckets(current, previous []RealTimeDataBucket) []RealTimeDataBucket {
+	if len(current) != len(previous) {
+		return current
+	}
+	delta := make([]RealTimeDataBucket, len(current))
+	for i := range current {
+		if current[i].UpperBound != previous[i].UpperBound || current[i].Count < previous[i].Count {
+			return current
+		}
+		delta[i] = RealTimeDataBucket{UpperBound: current[i].UpperBound, Count: current[i].Count - previous[i].Count}
+		if i > 0 && delta[i].Count < delta[i-1].Count {
+			return current
+		}
+	}
+	return delta
+}
+
+// Add the buckets of two series with the same upper bounds
+func SumBuckets(a, b []RealTimeDataBucket) []RealTimeDataBucket {
+	if len(a) == 0 {
+		return append([]RealTimeDataBucket(nil), b...)
+	}
+	sum := append([]RealTimeDataBucket(nil), a...)
+	for _, bucket := range b {
+		i := sort.Search(len(sum), func(i int) bool { return sum[i].UpperBound >= bucket.UpperBound })
+		if i < len(sum) && sum[i].UpperBound == bucket.UpperBound {
+			sum[i].Count += bucket.Count
+		}
+	}
+	return sum
+}
@@ -1,110 +1,419 @@
 package realtimedata
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	maxLineSize = 1024 * 1024
 
-	"github.com/sirupsen/logrus"
+	// FNV-1a 64 bit
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
 )
 
-func (d *RealTimeData) AddDescription(metric string, line string) {
-	description := strings.ReplaceAll(line, "# HELP "+metric, "")
-	description = strings.TrimSpace(description)
-	i := d.findMetricByName(metric)
-	if i >= 0 {
-		d.Metrics[i].Description = description
-	} else {
-		d.Metrics = append(d.Metrics, RealTimeDataMetric{
-			Name:        metric,
-			Description: description,
-		})
+// Identifies a series over scrapes
+func SeriesID(metric string, hash uint64) string {
+	return metric + strconv.FormatUint(hash, 16)
+}
+
+// Copy of the data which the caller owns, later parses don't change it.
+// The labels and buckets of a value are never modified after parsing and are shared.
+func (d *RealTimeData) Snapshot() RealTimeData {
+	snapshot := RealTimeData{
+		Metrics:      make([]RealTimeDataMetric, len(d.Metrics)),
+		Generation:   d.Generation,
+		Time:         d.Time,
+		PreviousTime: d.PreviousTime,
+		Bytes:        d.Bytes,
+	}
+	for i, m := range d.Metrics {
+		snapshot.Metrics[i] = RealTimeDataMetric{
+			Name:        m.Name,
+			Description: m.Description,
+			Type:        m.Type,
+			Values:      append([]RealTimeDataMetricValue(nil), m.Values...),
+			Bytes:       m.Bytes,
+		}
 	}
+	return snapshot
 }
 
-func (d *RealTimeData) AddType(metric string, line string) {
-	metrictype := strings.ReplaceAll(line, "# TYPE "+metric, "")
-	metrictype = strings.TrimSpace(metrictype)
-	i := d.findMetricByName(metric)
-	if i >= 0 {
-		d.Metrics[i].Type = metrictype
-	} else {
-		d.Metrics = append(d.Metrics, RealTimeDataMetric{
-			Name: metric,
-			Type: metrictype,
-		})
+// Remove the metrics which are no longer selected
+func (d *RealTimeData) Select(selector Selector) {
+	metrics := make([]RealTimeDataMetric, 0, len(d.Metrics))
+	for _, m := range d.Metrics {
+		if selector(m.Name) {
+			metrics = append(metrics, m)
+		}
 	}
+	d.Metrics = metrics
+	d.index = nil // rebuild on next use
 }
 
-func (d *RealTimeData) AddValue(metric string, line string) {
-	l := strings.Split(line, " ")
-	if len(l) < 2 { // needs better errorhandling?
-		logrus.Errorf("metric line is not compliant %s", line)
+// Start parsing a new scrape
+func (d *RealTimeData) NextGeneration() {
+	d.Generation++
+	d.PreviousTime = d.Time
+	d.Time = time.Now()
+	d.Bytes = 0
+	for i := range d.Metrics {
+		d.Metrics[i].Bytes = 0
+	}
+}
+
+// Remove the values which are missing in the last scrapes, after <= 0 never removes values
+func (d *RealTimeData) EvictStale(after int) {
+	if after <= 0 {
 		return
 	}
-	labels := strings.ReplaceAll(l[0], metric, " ")
-	labels = strings.TrimSpace(labels)
+	for i := range d.Metrics {
+		values := make([]RealTimeDataMetricValue, 0, len(d.Metrics[i].Values))
+		for _, v := range d.Metrics[i].Values {
+			if d.Generation-v.LastSeen < after {
+				values = append(values, v)
+			}
+		}
+		d.Metrics[i].Values = values
+		d.Metrics[i].index = nil // rebuild on next use
+	}
+}
 
-	labels = labels[strings.Index(labels, "{")+1 : strings.Index(labels, "}")]
+// Parse a metrics page in the Prometheus text format line by line.
+// Only metrics accepted by the selector are kept, a nil selector keeps all metrics.
+// Histograms and summaries keep the _sum series as value (and the quantiles of a summary as
+// separate values), the _count series and the buckets are kept with the value.
+func (d *RealTimeData) Parse(r io.Reader, selector Selector) error {
+	selected := make(map[string]bool) // selector result per name
+	isSelected := func(name []byte) bool {
+		if s, ok := selected[string(name)]; ok {
+			return s
+		}
+		s := selector == nil || selector(string(name))
+		selected[string(name)] = s
+		return s
+	}
 
-	value := l[1]
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		d.Bytes += len(line) + 1
+		if len(line) == 0 {
+			continue
+		}
+		var m *RealTimeDataMetric
+		if line[0] == '#' {
+			m = d.parseComment(line, isSelected)
+		} else {
+			m = d.parseSample(line, isSelected)
+		}
+		if m != nil {
+			m.Bytes += len(line) + 1
+		}
+	}
+	return scanner.Err()
+}
 
-	i := d.findMetricByName(metric)
-	if i == -1 { // if metric doesn't exists create metric and get index
-		d.Metrics = append(d.Metrics, RealTimeDataMetric{
-			Name: metric,
-		})
-		i = d.findMetricByName(metric)
-	} else {
-		// if type is histogram we only want the sum (?) not the buckets.
-		if d.Metrics[i].Type == "histogram" {
-			if !strings.HasPrefix(line, metric+"_sum") {
-				return
+// Merge a page parsed into its own data, like Parse of the page would, so a page can be parsed
+// without holding the lock of the data. NextGeneration is called before as for Parse.
+func (d *RealTimeData) Merge(page RealTimeData) {
+	d.Bytes += page.Bytes
+	for _, pm := range page.Metrics {
+		m := d.metric([]byte(pm.Name))
+		if pm.Description != "" {
+			m.Description = pm.Description
+		}
+		if pm.Type != "" {
+			m.Type = pm.Type
+		}
+		m.Bytes += pm.Bytes
+		for _, pv := range pm.Values {
+			vi := m.valueIndex(pv.Hash)
+			if vi < 0 {
+				m.index[pv.Hash] = len(m.Values)
+				pv.PreviousValue, pv.PreviousBuckets = "", nil
+				pv.FirstSeen, pv.LastSeen = d.Generation, d.Generation
+				m.Values = append(m.Values, pv)
+				continue
+			}
+			v := &m.Values[vi]
+			if v.LastSeen != d.Generation {
+				v.PreviousValue = v.Value
+				v.LastSeen = d.Generation
+				if v.Buckets != nil {
+					v.PreviousBuckets = v.Buckets
+				}
+			}
+			if pv.Value != "" {
+				v.Value = pv.Value
 			}
+			if pv.Count != "" {
+				v.Count = pv.Count
+			}
+			v.Buckets = pv.Buckets
 		}
 	}
-	hash := getHash(labels)
-	vi := d.findValueByHash(i, hash)
-	if vi >= 0 {
-		d.Metrics[i].Values[vi].Value = value
+}
+
+// Handle # HELP and # TYPE lines, returns the metric of the line or nil if it isn't selected
+func (d *RealTimeData) parseComment(line []byte, isSelected func([]byte) bool) *RealTimeDataMetric {
+	var help bool
+	switch {
+	case bytes.HasPrefix(line, []byte("# HELP ")):
+		help = true
+	case bytes.HasPrefix(line, []byte("# TYPE ")):
+	default:
+		return nil
+	}
+	rest := line[len("# HELP "):]
+	name, text, _ := bytes.Cut(rest, []byte(" "))
+	if !isSelected(name) {
+		return nil
+	}
+	m := d.metric(name)
+	if help {
+		m.Description = string(bytes.TrimSpace(text))
 	} else {
-		newLabels := []RealTimeDataMetricLabel{}
-		for _, ll := range strings.Split(labels, ",") {
-			ll = strings.ReplaceAll(ll, "\"", "")
-			label := strings.Split(ll, "=")
-			newLabels = append(newLabels, RealTimeDataMetricLabel{
-				Label: label[0],
-				Value: label[1],
-			})
+		m.Type = string(bytes.TrimSpace(text))
+	}
+	return m
+}
+
+// Handle a sample line, returns the metric of the line or nil if it isn't selected
+func (d *RealTimeData) parseSample(line []byte, isSelected func([]byte) bool) *RealTimeDataMetric {
+	nameEnd := bytes.IndexAny(line, "{ ")
+	if nameEnd <= 0 {
+		return nil
+	}
+	name := line[:nameEnd]
+
+	// the _sum, _count and _bucket series belong to the histogram or summary, also if these are selected themselves
+	var m *RealTimeDataMetric
+	base, suffix := cutSeriesSuffix(name)
+	if suffix != "" && isSelected(base) {
+		m = d.lookupMetric(base)
+		if m != nil && m.Type != "histogram" && (m.Type != "summary" || suffix == "_bucket") {
+			m = nil
 		}
-		d.Metrics[i].Values = append(d.Metrics[i].Values, RealTimeDataMetricValue{
-			SHA256: hash,
-			Value:  value,
-			Labels: newLabels,
-		})
 	}
+	if m == nil {
+		suffix = ""
+		if !isSelected(name) {
+			return nil
+		}
+		m = d.metric(name)
+	}
+
+	rest := line[nameEnd:]
+	var labels []byte
+	if rest[0] == '{' {
+		end := labelsEnd(rest)
+		if end < 0 {
+			return m
+		}
+		labels = rest[1:end]
+		rest = rest[end+1:]
+	}
+	rest = bytes.TrimLeft(rest, " ")
+	value, _, _ := bytes.Cut(rest, []byte(" "))
+	if len(value) == 0 {
+		return m
+	}
+
+	var le []byte
+	if suffix == "_bucket" {
+		if labels, le = cutLabel(labels, "le"); le == nil {
+			return m
+		}
+	}
+
+	v := d.value(m, labels)
+	switch suffix {
+	case "_bucket":
+		upperBound, err := strconv.ParseFloat(string(le), 64)
+		if err != nil {
+			return m
+		}
+		count, err := strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return m
+		}
+		v.Buckets = append(v.Buckets, RealTimeDataBucket{UpperBound: upperBound, Count: count})
+	case "_count":
+		if v.Count != string(value) {
+			v.Count = string(value)
+		}
+	default:
+		if v.Value != string(value) {
+			v.Value = string(value)
+		}
+	}
+	return m
+}
+
+// Get or add the value of a label set, the first time in a scrape the current values become the previous values
+func (d *RealTimeData) value(m *RealTimeDataMetric, labels []byte) *RealTimeDataMetricValue {
+	hash := hashLabels(labels)
+	if vi := m.valueIndex(hash); vi >= 0 {
+		v := &m.Values[vi]
+		if v.LastSeen != d.Generation {
+			v.PreviousValue = v.Value
+			v.LastSeen = d.Generation
+			if v.Buckets != nil { // new slice, snapshots share the old one
+				v.PreviousBuckets = v.Buckets
+				v.Buckets = make([]RealTimeDataBucket, 0, len(v.PreviousBuckets))
+			}
+		}
+		return v
+	}
+	m.index[hash] = len(m.Values)
+	m.Values = append(m.Values, RealTimeDataMetricValue{
+		Labels:    parseLabels(labels),
+		Hash:      hash,
+		FirstSeen: d.Generation,
+		LastSeen:  d.Generation,
+	})
+	return &m.Values[len(m.Values)-1]
+}
+
+// Split the _sum, _count or _bucket suffix of a histogram or summary series
+func cutSeriesSuffix(name []byte) ([]byte, string) {
+	for _, suffix := range []string{"_sum", "_count", "_bucket"} {
+		if base, ok := bytes.CutSuffix(name, []byte(suffix)); ok {
+			return base, suffix
+		}
+	}
+	return name, ""
+}
+
+// Remove a label from the labels and return its value, the value is nil if the label is missing
+func cutLabel(labels []byte, label string) ([]byte, []byte) {
+	prefix := []byte(label + `="`)
+	start := 0
+	for {
+		i := bytes.Index(labels[start:], prefix)
+		if i < 0 {
+			return labels, nil
+		}
+		start += i
+		if start == 0 || labels[start-1] == ',' {
+			break
+		}
+		start += len(prefix)
+	}
+	valueStart := start + len(prefix)
+	valueEnd := bytes.IndexByte(labels[valueStart:], '"')
+	if valueEnd < 0 {
+		return labels, nil
+	}
+	value := labels[valueStart : valueStart+valueEnd]
+	end := valueStart + valueEnd + 1
+	if end >= len(labels) { // last label, which is the usual place of le
+		return bytes.TrimRight(labels[:start], ","), value
+	}
+	stripped := append([]byte{}, labels[:start]...)
+	return append(stripped, bytes.TrimLeft(labels[end:], ",")...), value
+}
+
+// Get a metric by name, nil if it doesn't exist
+func (d *RealTimeData) lookupMetric(name []byte) *RealTimeDataMetric {
+	if d.index == nil {
+		d.index = make(map[string]int, len(d.Metrics))
+		for i, m := range d.Metrics {
+			d.index[m.Name] = i
+		}
+	}
+	if i, ok := d.index[string(name)]; ok {
+		return &d.Metrics[i]
+	}
+	return nil
+}
+
+// Get or add a metric by name
+func (d *RealTimeData) metric(name []byte) *RealTimeDataMetric {
+	if m := d.lookupMetric(name); m != nil {
+		return m
+	}
+	d.Metrics = append(d.Metrics, RealTimeDataMetric{Name: string(name)})
+	d.index[string(name)] = len(d.Metrics) - 1
+	return &d.Metrics[len(d.Metrics)-1]
 }
 
-func (d *RealTimeData) findValueByHash(index int, hash string) int {
-	for i, m := range d.Metrics[index].Values {
-		if m.SHA256 == hash {
-			return i
+// Index of a value by label hash, -1 if the value doesn't exist
+func (m *RealTimeDataMetric) valueIndex(hash uint64) int {
+	if m.index == nil {
+		m.index = make(map[uint64]int, len(m.Values))
+		for i, v := range m.Values {
+			m.index[v.Hash] = i
 		}
 	}
+	if i, ok := m.index[hash]; ok {
+		return i
+	}
 	return -1
 }
 
-func (d *RealTimeData) findMetricByName(name string) int {
-	for i, m := range d.Metrics {
-		if name == m.Name {
-			return i
+// Position of the closing } of the labels, skipping quoted values
+func labelsEnd(s []byte) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '}':
+			if !quoted {
+				return i
+			}
 		}
 	}
 	return -1
 }
 
-func getHash(s string) string {
-	h := sha256.New()
-	h.Write([]byte(s))
-	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+// Parse name="value" pairs, unescaping the values
+func parseLabels(s []byte) []RealTimeDataMetricLabel {
+	labels := []RealTimeDataMetricLabel{}
+	for len(s) > 0 {
+		s = bytes.TrimLeft(s, ", ")
+		eq := bytes.IndexByte(s, '=')
+		if eq < 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			break
+		}
+		name := string(bytes.TrimSpace(s[:eq]))
+		s = s[eq+2:]
+		var value strings.Builder
+		i := 0
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(s[i])
+		}
+		labels = append(labels, RealTimeDataMetricLabel{Label: name, Value: value.String()})
+		if i >= len(s) {
+			break
+		}
+		s = s[i+1:]
+	}
+	return labels
+}
+
+func hashLabels(s []byte) uint64 {
+	h := uint64(offset64)
+	for _, c := range s {
+		h ^= uint64(c)
+		h *= prime64
+	}
+	return h
 }
@@ -0,0 +1,249 @@
+package realtimedata
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const samplePayload = `# HELP apiserver_flowcontrol_current_limit_seats current derived number of execution seats available to each priority level
+# TYPE apiserver_flowcontrol_current_limit_seats gauge
+apiserver_flowcontrol_current_limit_seats{priority_level="catch-all"} 13
+apiserver_flowcontrol_current_limit_seats{priority_level="workload-low"} 245
+# HELP apiserver_flowcontrol_request_wait_duration_seconds Length of time a request spent waiting in its queue
+# TYPE apiserver_flowcontrol_request_wait_duration_seconds histogram
+apiserver_flowcontrol_request_wait_duration_seconds_bucket{execute="true",flow_schema="exempt",priority_level="exempt",le="0.1"} 7
+apiserver_flowcontrol_request_wait_duration_seconds_sum{execute="true",flow_schema="exempt",priority_level="exempt"} 0.25
+apiserver_flowcontrol_request_wait_duration_seconds_count{execute="true",flow_schema="exempt",priority_level="exempt"} 7
+# TYPE other_metric counter
+other_metric{path="/a,b",note="say \"hi\" {x}"} 3 1700000000000
+`
+
+func TestParse(t *testing.T) {
+	selected := map[string]bool{
+		"apiserver_flowcontrol_current_limit_seats":           true,
+		"apiserver_flowcontrol_request_wait_duration_seconds": true,
+		"other_metric": true,
+	}
+	d := RealTimeData{}
+	d.NextGeneration()
+	if err := d.Parse(strings.NewReader(samplePayload), func(name string) bool { return selected[name] }); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Metrics) != 3 {
+		t.Fatalf("expected 3 metrics, got %d", len(d.Metrics))
+	}
+	seats := d.Metrics[0]
+	if seats.Type != "gauge" || len(seats.Values) != 2 || seats.Values[1].Value != "245" {
+		t.Errorf("unexpected gauge %+v", seats)
+	}
+	wait := d.Metrics[1]
+	if wait.Type != "histogram" || len(wait.Values) != 1 || wait.Values[0].Value != "0.25" {
+		t.Errorf("expected one histogram value with the sum, got %+v", wait)
+	}
+	if h := wait.Values[0]; h.Count != "7" || len(h.Buckets) != 1 || h.Buckets[0].UpperBound != 0.1 || len(h.Labels) != 3 {
+		t.Errorf("unexpected histogram count, buckets or labels %+v", h)
+	}
+	if d.Bytes != len(samplePayload) || seats.Bytes+wait.Bytes+d.Metrics[2].Bytes != len(samplePayload) {
+		t.Errorf("unexpected payload bytes %d, metric bytes %d %d %d", d.Bytes, seats.Bytes, wait.Bytes, d.Metrics[2].Bytes)
+	}
+	other := d.Metrics[2].Values[0]
+	if other.Value != "3" || len(other.Labels) != 2 || other.Labels[0].Value != "/a,b" || other.Labels[1].Value != `say "hi" {x}` {
+		t.Errorf("unexpected labels %+v", other)
+	}
+
+	d.NextGeneration()
+	if err := d.Parse(strings.NewReader(strings.ReplaceAll(samplePayload, "} 245", "} 250")), func(name string) bool { return selected[name] }); err != nil {
+		t.Fatal(err)
+	}
+	v := d.Metrics[0].Values[1]
+	if len(d.Metrics[0].Values) != 2 || v.Value != "250" || v.PreviousValue != "245" || v.LastSeen != 2 || v.FirstSeen != 1 {
+		t.Errorf("unexpected update %+v", v)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	d := RealTimeData{}
+	d.NextGeneration()
+	if err := d.Parse(strings.NewReader(samplePayload), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Metrics) != 3 || d.Metrics[1].Values[0].Count != "7" {
+		t.Errorf("expected the histogram series in one metric, got %+v", d.Metrics)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	pages := []string{samplePayload, strings.ReplaceAll(strings.ReplaceAll(samplePayload, "} 245", "} 250"), "} 7\n", "} 9\n")}
+	parsed, merged := RealTimeData{}, RealTimeData{}
+	for _, page := range pages {
+		parsed.NextGeneration()
+		if err := parsed.Parse(strings.NewReader(page), nil); err != nil {
+			t.Fatal(err)
+		}
+		fresh := RealTimeData{}
+		if err := fresh.Parse(strings.NewReader(page), nil); err != nil {
+			t.Fatal(err)
+		}
+		merged.NextGeneration()
+		merged.Merge(fresh)
+		merged.Time, merged.PreviousTime = parsed.Time, parsed.PreviousTime
+		if a, b := parsed.Snapshot(), merged.Snapshot(); !reflect.DeepEqual(a, b) {
+			t.Errorf("expected the merged page to equal the parsed page:\n%+v\n%+v", a, b)
+		}
+	}
+}
+
+// Generate a metrics page of about size bytes with many families and series
+func generatePayload(size int) []byte {
+	var b bytes.Buffer
+	for family := 0; b.Len() < size; family++ {
+		name := fmt.Sprintf("apiserver_generated_metric_%d_total", family)
+		fmt.Fprintf(&b, "# HELP %s Generated counter number %d.\n", name, family)
+		fmt.Fprintf(&b, "# TYPE %s counter\n", name)
+		for series := 0; series < 500; series++ {
+			fmt.Fprintf(&b, "%s{flow_schema=\"schema-%d\",priority_level=\"level-%d\",verb=\"LIST\"} %d\n", name, series, series%7, series*family)
+		}
+	}
+	return b.Bytes()
+}
+
+var (
+	payloadOnce sync.Once
+	payload     []byte
+)
+
+// Page of 50MB for the benchmarks, generated the first time it is needed
+func loadPayload(b *testing.B) []byte {
+	b.StopTimer()
+	defer b.StartTimer()
+	payloadOnce.Do(func() { payload = generatePayload(50 * 1024 * 1024) })
+	return payload
+}
+
+func selectFamilies(count int) Selector {
+	selected := make(map[string]struct{}, count)
+	for i := 0; i < count; i++ {
+		selected[fmt.Sprintf("apiserver_generated_metric_%d_total", i*10)] = struct{}{}
+	}
+	return func(name string) bool {
+		_, ok := selected[name]
+		return ok
+	}
+}
+
+// A typical configuration with a handful of metrics
+func BenchmarkParse50MBSelected(b *testing.B) {
+	payload50MB := loadPayload(b)
+	selector := selectFamilies(7)
+	b.SetBytes(int64(len(payload50MB)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := RealTimeData{}
+		d.NextGeneration()
+		if err := d.Parse(bytes.NewReader(payload50MB), selector); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Every family of the page
+func BenchmarkParse50MBAll(b *testing.B) {
+	payload50MB := loadPayload(b)
+	b.SetBytes(int64(len(payload50MB)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := RealTimeData{}
+		d.NextGeneration()
+		if err := d.Parse(bytes.NewReader(payload50MB), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Scraping again into existing data, which only updates values
+func BenchmarkRescrape50MBAll(b *testing.B) {
+	payload50MB := loadPayload(b)
+	d := RealTimeData{}
+	d.NextGeneration()
+	if err := d.Parse(bytes.NewReader(payload50MB), nil); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(payload50MB)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.NextGeneration()
+		if err := d.Parse(bytes.NewReader(payload50MB), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func buckets(counts ...float64) []RealTimeDataBucket {
+	bounds := []float64{0.1, 0.5, 1, math.Inf(1)}
+	b := make([]RealTimeDataBucket, len(counts))
+	for i, count := range counts {
+		b[i] = RealTimeDataBucket{UpperBound: bounds[i], Count: count}
+	}
+	return b
+}
+
+func TestQuantile(t *testing.T) {
+	for _, test := range []struct {
+		q       float64
+		buckets []RealTimeDataBucket
+		want    float64
+	}{
+		{0.5, buckets(10, 60, 90, 100), 0.42},
+		{0.9, buckets(10, 60, 90, 100), 1},
+		{0.99, buckets(10, 60, 90, 100), 1}, // in the +Inf bucket, the highest finite bound
+		{0.05, buckets(10, 60, 90, 100), 0.05},
+		{0.5, buckets(0, 0, 0, 0), math.NaN()},
+		{0.5, buckets(1, 2, 3), math.NaN()}, // no +Inf bucket
+		{0.5, nil, math.NaN()},
+	} {
+		got := Quantile(test.q, test.buckets)
+		if math.IsNaN(test.want) != math.IsNaN(got) || (!math.IsNaN(got) && math.Abs(got-test.want) > 1e-9) {
+			t.Errorf("q%v of %v: expected %v, got %v", test.q, test.buckets, test.want, got)
+		}
+	}
+}
+
+func TestDeltaBuckets(t *testing.T) {
+	previous := buckets(10, 60, 90, 100)
+	for _, test := range []struct {
+		name    string
+		current []RealTimeDataBucket
+		want    []RealTimeDataBucket
+	}{
+		{"observations", buckets(15, 70, 100, 115), buckets(5, 10, 10, 15)},
+		{"reset", buckets(1, 2, 3, 3), buckets(1, 2, 3, 3)},
+		{"reset with more observations since", buckets(12, 61, 95, 140), buckets(12, 61, 95, 140)},
+		{"other buckets", buckets(15, 70, 115), buckets(15, 70, 115)},
+	} {
+		got := DeltaBuckets(test.current, previous)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+		for _, bucket := range got {
+			if bucket.Count < 0 {
+				t.Errorf("%s: negative bucket %v", test.name, got)
+			}
+		}
+	}
+}
+
+func TestSumBuckets(t *testing.T) {
+	if got := SumBuckets(buckets(1, 2, 3, 4), buckets(1, 1, 1, 1)); fmt.Sprint(got) != fmt.Sprint(buckets(2, 3, 4, 5)) {
+		t.Errorf("unexpected sum %v", got)
+	}
+	b := buckets(1, 2, 3, 4)
+	if got := SumBuckets(nil, b); fmt.Sprint(got) != fmt.Sprint(b) || &got[0] == &b[0] {
+		t.Errorf("expected a copy, got %v", got)
+	}
+}
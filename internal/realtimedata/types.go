@@ -1,7 +1,14 @@
 package realtimedata
 
+import "time"
+
 type RealTimeData struct {
-	Metrics []RealTimeDataMetric
+	Metrics      []RealTimeDataMetric
+	Generation   int            // number of parsed scrapes
+	Time         time.Time      // time of the last scrape
+	PreviousTime time.Time      // time of the scrape before
+	Bytes        int            // size of the last scraped page
+	index        map[string]int // metric name -> index in Metrics
 }
 
 type RealTimeDataMetric struct {
@@ -9,15 +16,32 @@ type RealTimeDataMetric struct {
 	Description string
 	Type        string
 	Values      []RealTimeDataMetricValue
+	Bytes       int            // size of the lines of this metric in the last scraped page
+	index       map[uint64]int // label hash -> index in Values
 }
 
 type RealTimeDataMetricValue struct {
-	Labels []RealTimeDataMetricLabel
-	Value  string
-	SHA256 string
+	Labels        []RealTimeDataMetricLabel
+	Value         string
+	PreviousValue string // value of the previous scrape
+	Hash          uint64 // FNV-1a hash of the label set
+	FirstSeen     int    // generation of the first scrape with this value
+	LastSeen      int    // generation of the last scrape with this value
+	// Histograms and summaries only
+	Count           string               // value of the _count series
+	Buckets         []RealTimeDataBucket // cumulative histogram buckets ordered by upper bound
+	PreviousBuckets []RealTimeDataBucket // buckets of the previous scrape
+}
+
+type RealTimeDataBucket struct {
+	UpperBound float64
+	Count      float64
 }
 
 type RealTimeDataMetricLabel struct {
 	Label string
 	Value string
 }
+
+// Selector decides if a metric family is kept while parsing
+type Selector func(name string) bool
@@ -3,36 +3,131 @@ package rxgo
 import (
 	"context"
 	"fmt"
-	"regexp"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/bvankampen/metrics-viewer/internal/alerts"
+	"github.com/bvankampen/metrics-viewer/internal/apf"
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
+	"github.com/bvankampen/metrics-viewer/internal/events"
+	"github.com/bvankampen/metrics-viewer/internal/filter"
+	"github.com/bvankampen/metrics-viewer/internal/history"
+	"github.com/bvankampen/metrics-viewer/internal/kubeconfig"
 	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
 	"github.com/bvankampen/metrics-viewer/internal/scraper"
+	"github.com/bvankampen/metrics-viewer/internal/sink"
+	"github.com/bvankampen/metrics-viewer/internal/source"
 	"github.com/bvankampen/metrics-viewer/internal/ui"
+	"github.com/mitchellh/go-homedir"
 	"github.com/reactivex/rxgo/v2"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"k8s.io/client-go/rest"
 )
 
 func Run(ctx *cli.Context) {
-	scraper := scraper.Scraper{}
-	scraper.Init(ctx)
+	var mutex sync.Mutex // guards appConfig against reloads
+	appConfig := *config.LoadAppConfig(ctx.String("config"))
+	currentConfig := func() config.ApplicationConfig {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return appConfig
+	}
+	scrapeInterval := func() time.Duration {
+		return time.Duration(currentConfig().Settings.ScrapeInterval) * time.Second
+	}
 
-	timer := rxgo.Interval(rxgo.WithDuration(time.Duration(scraper.ScrapeInterval()) * time.Second)).
-		Map(func(ctx context.Context, _ interface{}) (interface{}, error) {
-			return time.Now().Unix(), nil
-		})
+	src, err := newSource(ctx, appConfig)
+	if err != nil {
+		logrus.Fatalf("Unable to open source: %v", err)
+	}
+
+	timer := rxgo.Create([]rxgo.Producer{
+		func(ctx context.Context, ch chan<- rxgo.Item) {
+			for {
+				ch <- rxgo.Of(time.Now().Unix())
+				time.Sleep(scrapeInterval())
+			}
+		},
+	})
 
 	ui := ui.NewAppUI(ctx)
+	if reporter, ok := src.(source.Reporter); ok {
+		reporter.SetErrorHandler(ui.ShowError)
+	}
+	store := openHistory(appConfig.History)
+	defer store.Close()
+	ui.SetHistory(store)
+	if backfiller, ok := src.(source.Backfiller); ok && ctx.Duration("range") > 0 {
+		backfill(backfiller, store, ctx.Duration("range"), scrapeInterval())
+	}
+	sinksCtx, stopSinks := context.WithCancel(context.Background())
+	pushers := startSinks(sinksCtx, appConfig.Sinks, ui.ShowError)
+	defer func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		stopSinks()
+	}()
+	currentPushers := func() []*sink.Pusher {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return pushers
+	}
+
+	evaluator, err := alerts.New(appConfig.Alerts)
+	if err != nil {
+		logrus.Warnf("Unable to evaluate all alert rules: %v", err)
+	}
+
+	err = config.Watch(ctx.String("config"), func(newConfig *config.ApplicationConfig, err error) {
+		if err != nil {
+			ui.ShowError(fmt.Errorf("config not reloaded: %v", err))
+			return
+		}
+		mutex.Lock()
+		if !reflect.DeepEqual(appConfig.Sinks, newConfig.Sinks) {
+			stopSinks() // the scrapes still queued for the old sinks are dropped
+			sinksCtx, stopSinks = context.WithCancel(context.Background())
+			pushers = startSinks(sinksCtx, newConfig.Sinks, ui.ShowError)
+		}
+		appConfig = *newConfig
+		mutex.Unlock()
+		if err := evaluator.SetRules(newConfig.Alerts); err != nil {
+			ui.ShowError(err)
+		}
+		if configurable, ok := src.(source.Configurable); ok {
+			configurable.SetConfig(*newConfig)
+		}
+		ui.UpdateViews(newConfig.Views)
+		ui.ShowMessage("config reloaded")
+	})
+	if err != nil {
+		logrus.Warnf("Unable to watch config file for changes: %v", err)
+	}
+
+	// Metrics shown without a view, for the apiserver the configured metrics without the ones only scraped for the APF page
+	defaultMetrics := func() []string {
+		if !isAPIServer(src) {
+			return []string{}
+		}
+		config := currentConfig()
+		return config.AllMetrics()
+	}
 
 	filterChan := make(chan rxgo.Item)
 	sortChan := make(chan rxgo.Item)
+	viewChan := make(chan rxgo.Item)
 	filterObservable := rxgo.FromChannel(filterChan)
 	sortObservable := rxgo.FromChannel(sortChan)
+	viewObservable := rxgo.FromChannel(viewChan)
 
 	go func() {
+		viewChan <- rxgo.Of(defaultMetrics())
 		filterChan <- rxgo.Of("")
 		sortChan <- rxgo.Of(map[string]interface{}{
 			"column":    0,
@@ -43,14 +138,26 @@ func Run(ctx *cli.Context) {
 	dataSource := rxgo.Create([]rxgo.Producer{
 		func(ctx context.Context, ch chan<- rxgo.Item) {
 			for {
-				data, err := scraper.Scrape()
+				data, err := src.Scrape()
+				if err != nil && !isAPIServer(src) {
+					ui.ShowError(err) // keep running, another target can be picked or the file fixed
+					time.Sleep(scrapeInterval())
+					continue
+				}
 				if err != nil {
 					ch <- rxgo.Error(err)
 					ui.Stop() // Stop UI to disable fatal errors.
 					continue
 				}
+				if err := store.Append(data); err != nil {
+					logrus.Debugf("Unable to keep history: %v", err)
+				}
+				for _, pusher := range currentPushers() {
+					pusher.Push(data)
+				}
+				ui.SetAlerts(evaluator.Evaluate(data))
 				ch <- rxgo.Of(data)
-				time.Sleep(1 * time.Second)
+				time.Sleep(scrapeInterval())
 			}
 		},
 	})
@@ -62,6 +169,7 @@ func Run(ctx *cli.Context) {
 				"currentTime": i[1],
 				"filterState": i[2],
 				"sortState":   i[3],
+				"viewState":   i[4],
 			}
 		},
 		[]rxgo.Observable{
@@ -69,6 +177,7 @@ func Run(ctx *cli.Context) {
 			timer,
 			filterObservable,
 			sortObservable,
+			viewObservable,
 		},
 	).Map(func(ctx context.Context, item interface{}) (interface{}, error) {
 		vMap := item.(map[string]interface{})
@@ -77,8 +186,9 @@ func Run(ctx *cli.Context) {
 		sortConfig := vMap["sortState"].(map[string]interface{})
 		sortColumn := sortConfig["column"].(int)
 		sortAsc := sortConfig["ascending"].(bool)
+		viewMetrics := vMap["viewState"].([]string)
 
-		filteredData := applyFilter(originalData, filter)
+		filteredData := applyFilter(applyView(originalData, viewMetrics), filter)
 		filteredSortedData := applySort(filteredData, sortColumn, sortAsc)
 
 		vMap["filteredSortedData"] = filteredSortedData
@@ -107,6 +217,46 @@ func Run(ctx *cli.Context) {
 	ui.SetFilterHandler(func(newFilter string) {
 		filterChan <- rxgo.Of(newFilter)
 	})
+	ui.SetViewHandler(func(metrics []string) {
+		if len(metrics) == 0 {
+			metrics = defaultMetrics()
+		}
+		viewChan <- rxgo.Of(metrics)
+	})
+	ui.SetViews(appConfig.Views)
+	if cluster, ok := src.(source.Kubernetes); ok {
+		apfClient, err := apf.NewClient(cluster.RestConfig())
+		if err != nil {
+			logrus.Warnf("Unable to create client for the APF configuration: %v", err)
+		} else {
+			ui.SetAPFSource(func() (apf.Configuration, error) {
+				return apfClient.Fetch(context.Background())
+			})
+		}
+		targets, err := discovery.New(cluster.RestConfig())
+		if err != nil {
+			logrus.Warnf("Unable to create client for the discovery of targets: %v", err)
+		} else {
+			ui.SetTargetSource(func() ([]discovery.Target, error) {
+				return targets.Targets(context.Background(), ctx.String("namespace"))
+			})
+		}
+		ui.SetTargetHandler(cluster.SetTarget)
+		if ctx.Bool("events") {
+			watcher, err := events.New(cluster.RestConfig(), ctx.String("events-namespace"), ctx.StringSlice("events-reason"))
+			if err != nil {
+				logrus.Warnf("Unable to create client for the events: %v", err)
+			} else {
+				ui.SetEventSource(func(onEvents func([]events.Event)) error {
+					return watcher.Run(context.Background(), onEvents, func(err error) {
+						ui.ShowError(fmt.Errorf("events not watched, retrying: %v", err))
+					})
+				})
+			}
+		}
+	} else {
+		ui.SetSourceName(src.String())
+	}
 	ui.SetSortHandler(func(column int, ascending bool) {
 		sortChan <- rxgo.Of(map[string]interface{}{
 			"column":    column,
@@ -117,13 +267,115 @@ func Run(ctx *cli.Context) {
 	ui.Run(observeChan)
 }
 
-func applyFilter(data realtimedata.RealTimeData, filter string) realtimedata.RealTimeData {
-	if filter == "" {
+// History on disk if a path is configured, otherwise in memory
+func openHistory(settings config.History) history.Store {
+	if settings.Path == "" {
+		return history.NewMemory(history.DefaultSize)
+	}
+	path, _ := homedir.Expand(settings.Path)
+	store, err := history.OpenDisk(path, history.DiskOptions{
+		Retention:          time.Duration(settings.Retention),
+		DownsampleAfter:    time.Duration(settings.DownsampleAfter),
+		DownsampleInterval: time.Duration(settings.DownsampleInterval),
+	})
+	if err != nil {
+		logrus.Warnf("Unable to open history in %s, keeping it in memory: %v", path, err)
+		return history.NewMemory(history.DefaultSize)
+	}
+	return store
+}
+
+// Fill the history with the past of the source
+func backfill(backfiller source.Backfiller, store history.Store, duration, step time.Duration) {
+	scrapes, err := backfiller.Backfill(duration, step)
+	if err != nil {
+		logrus.Warnf("Unable to load the history of the last %s: %v", duration, err)
+		return
+	}
+	for _, data := range scrapes {
+		if err := store.Append(data); err != nil {
+			logrus.Debugf("Unable to keep history: %v", err)
+		}
+	}
+}
+
+// Push the scrapes to the configured sinks in the background until the context is done, sinks which can't be created are skipped
+func startSinks(ctx context.Context, sinks []config.Sink, onError func(error)) []*sink.Pusher {
+	pushers := []*sink.Pusher{}
+	for _, settings := range sinks {
+		pusher, err := sink.New(settings)
+		if err != nil {
+			logrus.Warnf("Unable to push to sink %s: %v", settings.URL, err)
+			continue
+		}
+		go pusher.Run(ctx, onError)
+		pushers = append(pushers, pusher)
+	}
+	return pushers
+}
+
+var _ source.Kubernetes = (*scraper.Scraper)(nil)
+
+// The apiserver scraper, the generated metrics of --demo, the dumps of --file, the endpoint of --target or --url or the queries of a --prometheus server
+func newSource(ctx *cli.Context, appConfig config.ApplicationConfig) (source.Source, error) {
+	if ctx.Bool("demo") {
+		return source.NewDemo(time.Now().UnixNano(), appConfig), nil
+	}
+	if server := ctx.String("prometheus"); server != "" {
+		return source.NewPrometheus(server, ctx.StringSlice("query"), appConfig, func() *rest.Config {
+			return kubeconfig.LoadKubeConfig(ctx.String("kubeconfig"))
+		})
+	}
+	if file := ctx.String("file"); file != "" {
+		path, _ := homedir.Expand(file)
+		return source.NewFile(path, appConfig)
+	}
+	if name := ctx.String("target"); name != "" {
+		target, ok := appConfig.Target(name)
+		if !ok {
+			return nil, fmt.Errorf("target %q isn't configured", name)
+		}
+		return source.NewHTTP(target, appConfig)
+	}
+	if url := ctx.String("url"); url != "" {
+		return source.NewHTTP(config.Target{URL: url}, appConfig)
+	}
+	s := scraper.New(appConfig, kubeconfig.LoadKubeConfig(ctx.String("kubeconfig")))
+	s.AddMetrics(apf.Metrics...)
+	return s, nil
+}
+
+// Only scrape errors of the apiserver stop the app
+func isAPIServer(src source.Source) bool {
+	cluster, ok := src.(source.Kubernetes)
+	return ok && cluster.Target().IsAPIServer()
+}
+
+// Only keep the metrics of the view, no metrics keeps all metrics
+func applyView(data realtimedata.RealTimeData, metrics []string) realtimedata.RealTimeData {
+	if len(metrics) == 0 {
 		return data
 	}
-	regex, err := regexp.Compile(filter)
+	selected := make(map[string]struct{}, len(metrics))
+	for _, m := range metrics {
+		selected[m] = struct{}{}
+	}
+	viewMetrics := []realtimedata.RealTimeDataMetric{}
+	for _, metric := range data.Metrics {
+		if _, ok := selected[metric.Name]; ok {
+			viewMetrics = append(viewMetrics, metric)
+		}
+	}
+	return realtimedata.RealTimeData{Metrics: viewMetrics, Generation: data.Generation}
+}
+
+func applyFilter(data realtimedata.RealTimeData, filterText string) realtimedata.RealTimeData {
+	if filterText == "" {
+		return data
+	}
+	expression, err := filter.Compile(filterText)
 	if err != nil {
-		logrus.Errorf("Invalid filter regex: %v", err)
+		logrus.Errorf("Invalid filter: %v", err)
 		return data
 	}
 
@@ -131,14 +383,7 @@ func applyFilter(data realtimedata.RealTimeData, filter string) realtimedata.Rea
 	for _, metric := range data.Metrics {
 		filteredValues := []realtimedata.RealTimeDataMetricValue{}
 		for _, value := range metric.Values {
-			labelMatches := false
-			for _, label := range value.Labels {
-				if regex.MatchString(label.Label) || regex.MatchString(label.Value) {
-					labelMatches = true
-					break
-				}
-			}
-			if regex.MatchString(metric.Name) || regex.MatchString(value.Value) || labelMatches {
+			if filter.Match(expression, &metric, &value) {
 				filteredValues = append(filteredValues, value)
 			}
 		}
@@ -152,13 +397,13 @@ func applyFilter(data realtimedata.RealTimeData, filter string) realtimedata.Rea
 		}
 	}
 
-	return realtimedata.RealTimeData{Metrics: filteredMetrics}
+	return realtimedata.RealTimeData{Metrics: filteredMetrics, Generation: data.Generation}
 }
 
 func applySort(data realtimedata.RealTimeData, column int, ascending bool) realtimedata.RealTimeData {
 	sortedMetrics := []realtimedata.RealTimeDataMetric{}
 	for _, metric := range data.Metrics {
-		values := metric.Values
+		values := append([]realtimedata.RealTimeDataMetricValue(nil), metric.Values...) // don't reorder the scraper's values
 		sort.Slice(values, func(i, j int) bool {
 			var a, b string
 			switch column {
@@ -170,6 +415,11 @@ func applySort(data realtimedata.RealTimeData, column int, ascending bool) realt
 				a, b = aLabels, bLabels
 			case 2:
 				a, b = values[i].Value, values[j].Value
+				if x, err := strconv.ParseFloat(a, 64); err == nil { // numbers by value, not like text
+					if y, err := strconv.ParseFloat(b, 64); err == nil && x != y {
+						return (x < y) == ascending
+					}
+				}
 			}
 			if ascending {
 				return a < b
@@ -184,7 +434,7 @@ func applySort(data realtimedata.RealTimeData, column int, ascending bool) realt
 		})
 	}
 
-	return realtimedata.RealTimeData{Metrics: sortedMetrics}
+	return realtimedata.RealTimeData{Metrics: sortedMetrics, Generation: data.Generation}
 }
 
 func labelsToString(labels []realtimedata.RealTimeDataMetricLabel) string {
@@ -213,12 +463,19 @@ func convertToTableRows(data realtimedata.RealTimeData) []ui.TableRow {
 			}
 
 			// Create and append the TableRow
-			tableRows = append(tableRows, ui.TableRow{
+			row := ui.TableRow{
+				ID:         realtimedata.SeriesID(metric.Name, value.Hash),
 				MetricName: metric.Name,
 				Type:       metric.Type,
 				Labels:     labels,
 				Value:      value.Value,
-			})
+				New:        value.FirstSeen == data.Generation && data.Generation > 1,
+				Stale:      data.Generation - value.LastSeen,
+			}
+			if row.Stale == 0 {
+				row.PreviousValue = value.PreviousValue
+			}
+			tableRows = append(tableRows, row)
 		}
 	}
 	return tableRows
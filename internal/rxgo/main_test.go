@@ -0,0 +1,103 @@
+package rxgo
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/bvankampen/metrics-viewer/internal/scraper"
+	"github.com/bvankampen/metrics-viewer/internal/source"
+	"k8s.io/client-go/rest"
+)
+
+// Scrape and render at the same time, run with -race to check the snapshots aren't shared
+func TestConcurrentScrapeAndRender(t *testing.T) {
+	var scrapes atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := scrapes.Add(1)
+		fmt.Fprintln(w, "# TYPE apiserver_flowcontrol_current_inqueue_requests gauge")
+		for i := int64(0); i < 50; i++ {
+			if (i+n)%5 == 0 { // let series come and go
+				continue
+			}
+			fmt.Fprintf(w, "apiserver_flowcontrol_current_inqueue_requests{priority_level=\"level-%d\"} %d\n", i, (i*n)%17)
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.ApplicationConfig{Metrics: []string{"apiserver_flowcontrol_current_inqueue_requests"}}
+	cfg.Settings.EvictStaleAfter = 2
+	s := scraper.New(cfg, &rest.Config{Host: server.URL})
+
+	snapshots := make(chan realtimedata.RealTimeData)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(snapshots)
+		for i := 0; i < 50; i++ {
+			data, err := s.Scrape()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			snapshots <- data
+		}
+	}()
+
+	for data := range snapshots {
+		data := data
+		for column := 0; column < 3; column++ {
+			wg.Add(1)
+			go func(column int) {
+				defer wg.Done()
+				rows := convertToTableRows(applySort(applyFilter(data, "value>3"), column, column%2 == 0))
+				for _, row := range rows {
+					if row.MetricName != "apiserver_flowcontrol_current_inqueue_requests" {
+						t.Errorf("unexpected row %+v", row)
+					}
+				}
+			}(column)
+		}
+	}
+	wg.Wait()
+}
+
+// The pipeline from the demo source to the table rows
+func TestPipelineDemo(t *testing.T) {
+	demo := source.NewDemo(1, config.ApplicationConfig{})
+	var data realtimedata.RealTimeData
+	for i := 0; i < 3; i++ {
+		var err error
+		if data, err = demo.Scrape(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	view := applyView(data, []string{"apiserver_flowcontrol_current_limit_seats"})
+	rows := convertToTableRows(applySort(applyFilter(view, "value>20"), 2, false))
+	if len(rows) == 0 {
+		t.Fatal("expected rows")
+	}
+	previous := math.Inf(1)
+	for _, row := range rows {
+		if row.MetricName != "apiserver_flowcontrol_current_limit_seats" || row.ID == "" {
+			t.Errorf("unexpected row %+v", row)
+		}
+		value, _ := strconv.ParseFloat(row.Value, 64)
+		if value <= 20 || value > previous {
+			t.Errorf("expected values above 20 in descending order, got %s after %g", row.Value, previous)
+		}
+		previous = value
+	}
+	if rows[0].PreviousValue == "" {
+		t.Errorf("expected the value of the previous scrape, got %+v", rows[0])
+	}
+}
@@ -1,71 +1,141 @@
 package scraper
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
-	"strings"
 
 	"github.com/bvankampen/metrics-viewer/internal/config"
-	"github.com/bvankampen/metrics-viewer/internal/kubeconfig"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
 	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
 	"k8s.io/client-go/rest"
-
-	"github.com/urfave/cli"
 )
 
-func (s *Scraper) Init(ctx *cli.Context) {
-	s.ctx = *ctx
-	s.config = *config.LoadAppConfig(ctx.String("config"))
-	s.restConfig = *kubeconfig.LoadKubeConfig(ctx.String("kubeconfig"))
+// Create a scraper for the /metrics endpoint of the apiserver
+func New(config config.ApplicationConfig, restConfig *rest.Config) *Scraper {
+	s := &Scraper{}
+	s.init(config, restConfig)
+	return s
+}
+
+func (s *Scraper) init(config config.ApplicationConfig, restConfig *rest.Config) {
+	s.config = config
+	s.restConfig = *restConfig
 
 	c, _ := rest.HTTPClientFor(&s.restConfig)
 
 	s.httpClient = *c
 
-	request, _ := http.NewRequest("GET", s.restConfig.Host+"/metrics", nil)
+	s.setTarget(discovery.APIServer)
+}
+
+func (s *Scraper) setTarget(target discovery.Target) {
+	s.target = target
+	request, _ := http.NewRequest("GET", s.restConfig.Host+target.URLPath(), nil)
 	request.Header.Add("Authorization", "Bearer "+s.restConfig.BearerToken)
 	s.httpRequest = *request
 }
 
-func (s *Scraper) ScrapeInterval() int {
-	return s.config.Settings.ScrapeInterval
+// Scrape another target, the data of the previous target is dropped
+func (s *Scraper) SetTarget(target discovery.Target) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.setTarget(target)
+	s.data = realtimedata.RealTimeData{}
+	s.switches++
+}
+
+func (s *Scraper) Target() discovery.Target {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.target
 }
 
-func (s *Scraper) parse(metrics []byte) {
-	scanner := bufio.NewScanner(bytes.NewReader(metrics))
-	for scanner.Scan() {
-		metricLine := scanner.Text()
-		for _, m := range s.config.Metrics {
-			if strings.HasPrefix(metricLine, "# HELP "+m) { // Description
-				s.data.AddDescription(m, metricLine)
-			}
-			if strings.HasPrefix(metricLine, "# TYPE "+m) { // Metric Type
-				s.data.AddType(m, metricLine)
-			}
-			if strings.HasPrefix(metricLine, m) { // Value
-				s.data.AddValue(m, metricLine)
-			}
+func (s *Scraper) String() string {
+	return s.Target().String()
+}
+
+func (s *Scraper) RestConfig() *rest.Config {
+	return &s.restConfig
+}
+
+// Scrape metrics next to the configured ones, like the metrics of the APF dashboard
+func (s *Scraper) AddMetrics(names ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.extra = append(s.extra, names...)
+	s.metrics = nil
+}
+
+// Scrape every metric of the target, not only the configured ones
+func (s *Scraper) SelectAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.all = true
+}
+
+// Apply a reloaded config, the data of metrics which are still configured is kept
+func (s *Scraper) SetConfig(config config.ApplicationConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.config = config
+	s.metrics = nil
+	if selector := s.selector(); selector != nil {
+		s.data.Select(selector)
+	}
+}
+
+// Selector for the configured and extra metrics, nil for other targets than the apiserver which keep all metrics.
+// The selector doesn't use the fields of the scraper, so it can be used without the lock.
+func (s *Scraper) selector() realtimedata.Selector {
+	if s.all || !s.target.IsAPIServer() {
+		return nil
+	}
+	if s.metrics == nil {
+		s.metrics = make(map[string]struct{}, len(s.config.Metrics))
+		for _, m := range s.config.AllMetrics() {
+			s.metrics[m] = struct{}{}
+		}
+		for _, m := range s.extra {
+			s.metrics[m] = struct{}{}
 		}
 	}
+	metrics := s.metrics // replaced, not changed, by reloads
+	return func(name string) bool {
+		_, ok := metrics[name]
+		return ok
+	}
 }
 
+// Scrape the target, the page is parsed while it is read without the lock and merged with the lock,
+// so a slow target doesn't hold up reloads and the UI
 func (s *Scraper) Scrape() (realtimedata.RealTimeData, error) {
-	response, err := s.httpClient.Do(&s.httpRequest)
+	s.mutex.Lock()
+	request := s.httpRequest.Clone(context.Background())
+	switches := s.switches
+	selector := s.selector()
+	s.mutex.Unlock()
+
+	response, err := s.httpClient.Do(request)
 	if err != nil {
 		return realtimedata.RealTimeData{}, err
 	}
 	defer response.Body.Close()
-	if response.StatusCode == http.StatusOK {
-		metrics, err := io.ReadAll(response.Body)
-		if err != nil {
-			return realtimedata.RealTimeData{}, err
-		}
-		s.parse(metrics)
-	} else {
+	if response.StatusCode != http.StatusOK {
 		return realtimedata.RealTimeData{}, fmt.Errorf("unable to get metrics data http error %s", response.Status)
 	}
-	return s.data, nil
+	page := realtimedata.RealTimeData{}
+	if err := page.Parse(response.Body, selector); err != nil {
+		return realtimedata.RealTimeData{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if switches != s.switches { // the page of the previous target
+		return s.data.Snapshot(), nil
+	}
+	s.data.NextGeneration()
+	s.data.Merge(page)
+	s.data.EvictStale(s.config.Settings.EvictStaleAfter)
+	return s.data.Snapshot(), nil
 }
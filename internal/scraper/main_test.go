@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
+	"github.com/bvankampen/metrics-viewer/internal/fakeapiserver"
+	"github.com/bvankampen/metrics-viewer/internal/source"
+)
+
+func TestScrape(t *testing.T) {
+	demo := source.NewDemo(1, config.ApplicationConfig{})
+	server := fakeapiserver.New(demo.Page)
+	defer server.Close()
+
+	cfg := config.ApplicationConfig{Metrics: []string{
+		"apiserver_flowcontrol_current_limit_seats",
+		"apiserver_flowcontrol_request_wait_duration_seconds",
+	}}
+	s := New(cfg, server.RestConfig())
+	s.AddMetrics("go_gc_duration_seconds")
+
+	var types []string
+	for i := 0; i < 3; i++ {
+		data, err := s.Scrape()
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = types[:0]
+		for _, m := range data.Metrics {
+			types = append(types, m.Name+":"+m.Type)
+		}
+		if data.Generation != i+1 {
+			t.Errorf("expected generation %d, got %d", i+1, data.Generation)
+		}
+	}
+	expected := "apiserver_flowcontrol_current_limit_seats:gauge apiserver_flowcontrol_request_wait_duration_seconds:histogram go_gc_duration_seconds:summary"
+	if strings.Join(types, " ") != expected {
+		t.Errorf("expected the configured and extra metrics %s, got %s", expected, strings.Join(types, " "))
+	}
+	if server.Scrapes.Load() != 3 {
+		t.Errorf("expected 3 scrapes of the server, got %d", server.Scrapes.Load())
+	}
+}
+
+func TestScrapeTarget(t *testing.T) {
+	demo := source.NewDemo(1, config.ApplicationConfig{})
+	server := fakeapiserver.New(demo.Page)
+	defer server.Close()
+
+	s := New(config.ApplicationConfig{Metrics: []string{"apiserver_flowcontrol_current_limit_seats"}}, server.RestConfig())
+	s.SetTarget(discovery.Target{Kind: "service", Namespace: "default", Name: "app", Port: "8080", Path: "/metrics"})
+	data, err := s.Scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Metrics) < 5 {
+		t.Errorf("expected all metrics of another target than the apiserver, got %d", len(data.Metrics))
+	}
+}
+
+func TestScrapeUnauthorized(t *testing.T) {
+	demo := source.NewDemo(1, config.ApplicationConfig{})
+	server := fakeapiserver.New(demo.Page)
+	defer server.Close()
+
+	restConfig := server.RestConfig()
+	restConfig.BearerToken = "wrong"
+	if _, err := New(config.ApplicationConfig{}, restConfig).Scrape(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+}
@@ -2,18 +2,24 @@ package scraper
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
 	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
-	"github.com/urfave/cli"
 	"k8s.io/client-go/rest"
 )
 
 type Scraper struct {
+	mutex       sync.Mutex // guards the fields against reloads and target switches, isn't held while fetching
 	config      config.ApplicationConfig
 	restConfig  rest.Config
-	ctx         cli.Context
 	httpClient  http.Client
 	httpRequest http.Request
 	data        realtimedata.RealTimeData
+	metrics     map[string]struct{} // configured metrics by name
+	extra       []string            // metrics scraped for built-in pages
+	target      discovery.Target
+	all         bool // select all metrics
+	switches    int  // number of SetTarget calls, a page of the previous target isn't parsed
 }
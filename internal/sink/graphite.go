@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// Graphite plaintext protocol over TCP, the labels are sent as tags like name;tag=value
+type graphite struct {
+	socket  *socketSender
+	mapping mapping
+}
+
+// Characters with a meaning in a tagged series name
+var graphiteEscaper = strings.NewReplacer(";", "_", " ", "_", "~", "_", "=", "_", "!", "_", "^", "_")
+
+func (g *graphite) Encode(data realtimedata.RealTimeData, batchSize int) ([][]byte, error) {
+	all := flatten(data, nil)
+	timestamp := strconv.FormatInt(data.Time.Unix(), 10)
+	bodies := [][]byte{}
+	var body []byte
+	lines := 0
+	for _, s := range all {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+		body = append(body, graphiteEscaper.Replace(g.mapping.name(s.name))...)
+		for _, tag := range g.mapping.tagsOf(s.labels) {
+			if tag.Value == "" { // empty tag values aren't allowed
+				continue
+			}
+			body = append(body, ';')
+			body = append(body, graphiteEscaper.Replace(tag.Label)...)
+			body = append(body, '=')
+			body = append(body, graphiteEscaper.Replace(tag.Value)...)
+		}
+		body = append(body, ' ')
+		body = strconv.AppendFloat(body, s.value, 'f', -1, 64)
+		body = append(body, ' ')
+		body = append(body, timestamp...)
+		body = append(body, '\n')
+		if lines++; lines == batchSize {
+			bodies = append(bodies, body)
+			body, lines = nil, 0
+		}
+	}
+	if lines > 0 {
+		bodies = append(bodies, body)
+	}
+	return bodies, nil
+}
+
+func (g *graphite) Send(ctx context.Context, body []byte) error {
+	return g.socket.send(ctx, body)
+}
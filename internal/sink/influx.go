@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// InfluxDB line protocol with the value in the field value, written over HTTP or UDP
+type influx struct {
+	sender  *httpSender
+	socket  *socketSender // set for udp:// urls
+	mapping mapping
+}
+
+var influxHeader = http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+func (i *influx) Encode(data realtimedata.RealTimeData, batchSize int) ([][]byte, error) {
+	all := flatten(data, nil)
+	timestamp := strconv.FormatInt(data.Time.UnixNano(), 10)
+	bodies := [][]byte{}
+	var body []byte
+	lines := 0
+	for _, s := range all {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) { // not a valid field value
+			continue
+		}
+		body = append(body, measurementEscaper.Replace(i.mapping.name(s.name))...)
+		for _, tag := range i.mapping.tagsOf(s.labels) {
+			if tag.Value == "" { // empty tag values aren't allowed
+				continue
+			}
+			body = append(body, ',')
+			body = append(body, tagEscaper.Replace(tag.Label)...)
+			body = append(body, '=')
+			body = append(body, tagEscaper.Replace(tag.Value)...)
+		}
+		body = append(body, " value="...)
+		body = strconv.AppendFloat(body, s.value, 'g', -1, 64)
+		body = append(body, ' ')
+		body = append(body, timestamp...)
+		body = append(body, '\n')
+		if lines++; lines == batchSize {
+			bodies = append(bodies, body)
+			body, lines = nil, 0
+		}
+	}
+	if lines > 0 {
+		bodies = append(bodies, body)
+	}
+	return bodies, nil
+}
+
+func (i *influx) Send(ctx context.Context, body []byte) error {
+	if i.socket != nil {
+		return i.socket.send(ctx, body)
+	}
+	return i.sender.post(ctx, body, influxHeader)
+}
@@ -0,0 +1,288 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queueSize       = 10   // scrapes waiting to be pushed, older scrapes are dropped
+	maxDatagramSize = 1400 // fits in the usual MTU without fragmentation
+)
+
+var retryBackoff = 500 * time.Millisecond // shortened by the tests
+
+// Create the pusher for a configured sink
+func New(cfg config.Sink) (*Pusher, error) {
+	var sink Sink
+	var err error
+	sender := newHTTPSender(cfg)
+	switch cfg.Type {
+	case "remote_write":
+		sink = &remoteWrite{sender: sender, externalLabels: cfg.ExternalLabels}
+	case "otlp":
+		sink = &otlp{sender: sender, externalLabels: cfg.ExternalLabels}
+	case "influx":
+		influx := &influx{sender: sender, mapping: newMapping(cfg)}
+		if strings.HasPrefix(cfg.URL, "udp://") {
+			if influx.socket, err = newSocketSender(cfg); err != nil {
+				return nil, err
+			}
+		}
+		sink = influx
+	case "graphite":
+		socket, err := newSocketSender(cfg)
+		if err != nil {
+			return nil, err
+		}
+		sink = &graphite{socket: socket, mapping: newMapping(cfg)}
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+	}
+	return &Pusher{config: cfg, sink: sink, queue: make(chan realtimedata.RealTimeData, queueSize)}, nil
+}
+
+func (p *Pusher) String() string {
+	return fmt.Sprintf("%s %s", p.config.Type, p.config.URL)
+}
+
+// Queue a scrape, the oldest waiting scrape is dropped if the sink can't keep up
+func (p *Pusher) Push(data realtimedata.RealTimeData) {
+	for {
+		select {
+		case p.queue <- data:
+			return
+		default:
+		}
+		select {
+		case <-p.queue:
+			logrus.Debugf("Sink %s can't keep up, dropped a scrape", p)
+		default:
+		}
+	}
+}
+
+// Push the queued scrapes until the context is done, a scrape which can't be pushed is passed to onError
+func (p *Pusher) Run(ctx context.Context, onError func(error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case data := <-p.queue:
+			if err := p.push(ctx, data); err != nil {
+				onError(fmt.Errorf("unable to push to sink %s: %v", p, err))
+			}
+		}
+	}
+}
+
+func (p *Pusher) push(ctx context.Context, data realtimedata.RealTimeData) error {
+	bodies, err := p.sink.Encode(data, p.config.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, body := range bodies {
+		if err := p.send(ctx, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send a batch, retrying with an exponential backoff
+func (p *Pusher) send(ctx context.Context, body []byte) error {
+	var err error
+	for attempt := 0; attempt <= p.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryBackoff << (attempt - 1)):
+			}
+		}
+		requestCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.Timeout))
+		err = p.sink.Send(requestCtx, body)
+		cancel()
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) {
+			return err
+		}
+		logrus.Debugf("Sink %s attempt %d failed: %v", p, attempt+1, err)
+	}
+	return err
+}
+
+// Current series of a scrape with the external labels, which don't override the labels of a series
+func flatten(data realtimedata.RealTimeData, externalLabels map[string]string) []series {
+	all := []series{}
+	for _, metric := range data.Metrics {
+		for _, value := range metric.Values {
+			if value.LastSeen != data.Generation {
+				continue
+			}
+			labels := withExternalLabels(value.Labels, externalLabels)
+			if metric.Type != "histogram" && (metric.Type != "summary" || value.Count == "") {
+				if v, err := strconv.ParseFloat(value.Value, 64); err == nil {
+					all = append(all, series{name: metric.Name, labels: labels, value: v})
+				}
+				continue
+			}
+			if v, err := strconv.ParseFloat(value.Value, 64); err == nil {
+				all = append(all, series{name: metric.Name + "_sum", labels: labels, value: v})
+			}
+			if v, err := strconv.ParseFloat(value.Count, 64); err == nil {
+				all = append(all, series{name: metric.Name + "_count", labels: labels, value: v})
+			}
+			for _, bucket := range value.Buckets {
+				le := realtimedata.RealTimeDataMetricLabel{Label: "le", Value: formatBound(bucket.UpperBound)}
+				all = append(all, series{name: metric.Name + "_bucket", labels: sortLabels(append(labels[:len(labels):len(labels)], le)), value: bucket.Count})
+			}
+		}
+	}
+	return all
+}
+
+func withExternalLabels(labels []realtimedata.RealTimeDataMetricLabel, externalLabels map[string]string) []realtimedata.RealTimeDataMetricLabel {
+	all := append([]realtimedata.RealTimeDataMetricLabel(nil), labels...)
+	for name, value := range externalLabels {
+		found := false
+		for _, l := range labels {
+			found = found || l.Label == name
+		}
+		if !found {
+			all = append(all, realtimedata.RealTimeDataMetricLabel{Label: name, Value: value})
+		}
+	}
+	return sortLabels(all)
+}
+
+func sortLabels(labels []realtimedata.RealTimeDataMetricLabel) []realtimedata.RealTimeDataMetricLabel {
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Label < labels[j].Label })
+	return labels
+}
+
+// Upper bound like Prometheus writes it
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+func newHTTPSender(cfg config.Sink) *httpSender {
+	header := http.Header{}
+	for name, value := range cfg.Headers {
+		header.Set(name, value)
+	}
+	return &httpSender{url: cfg.URL, header: header, client: &http.Client{}}
+}
+
+// Post a body, 4xx responses other than 429 are permanent errors
+func (s *httpSender) post(ctx context.Context, body []byte, header http.Header) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	for name, values := range s.header {
+		request.Header[name] = values
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 == 2 {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	err = fmt.Errorf("%s: %s", response.Status, bytes.TrimSpace(message))
+	if response.StatusCode/100 == 4 && response.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+func newSocketSender(cfg config.Sink) (*socketSender, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &socketSender{network: u.Scheme, address: u.Host}, nil
+}
+
+// Write a body on a new connection, over UDP split at the lines
+func (s *socketSender) send(ctx context.Context, body []byte) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if s.network != "udp" {
+		_, err = conn.Write(body)
+		return err
+	}
+	for len(body) > 0 {
+		end := len(body)
+		if end > maxDatagramSize {
+			// the last line which fits, a longer line is sent on its own
+			if end = bytes.LastIndexByte(body[:maxDatagramSize], '\n') + 1; end == 0 {
+				end = bytes.IndexByte(body, '\n') + 1
+			}
+			if end == 0 {
+				end = len(body)
+			}
+		}
+		if _, err := conn.Write(body[:end]); err != nil {
+			return err
+		}
+		body = body[end:]
+	}
+	return nil
+}
+
+func newMapping(cfg config.Sink) mapping {
+	return mapping{prefix: cfg.Prefix, separator: cfg.NameSeparator, tags: cfg.Tags, externalLabels: cfg.ExternalLabels}
+}
+
+func (m mapping) name(name string) string {
+	if m.separator != "" {
+		name = strings.ReplaceAll(name, "_", m.separator)
+	}
+	return m.prefix + name
+}
+
+// Tags of a series sorted by name, the external labels don't override the labels of the series
+func (m mapping) tagsOf(labels []realtimedata.RealTimeDataMetricLabel) []realtimedata.RealTimeDataMetricLabel {
+	tags := []realtimedata.RealTimeDataMetricLabel{}
+	for _, l := range labels {
+		if len(m.tags) == 0 {
+			tags = append(tags, l)
+		} else if name, ok := m.tags[l.Label]; ok {
+			tags = append(tags, realtimedata.RealTimeDataMetricLabel{Label: name, Value: l.Value})
+		}
+	}
+	return withExternalLabels(tags, m.externalLabels)
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
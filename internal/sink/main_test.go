@@ -0,0 +1,400 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const samplePage = `# TYPE apiserver_flowcontrol_current_inqueue_requests gauge
+apiserver_flowcontrol_current_inqueue_requests{cluster="a",priority_level="catch-all"} 3
+apiserver_flowcontrol_current_inqueue_requests{priority_level="workload-low"} 5
+# TYPE apiserver_flowcontrol_dispatched_requests_total counter
+apiserver_flowcontrol_dispatched_requests_total{priority_level="catch-all"} 120
+# TYPE apiserver_flowcontrol_request_wait_duration_seconds histogram
+apiserver_flowcontrol_request_wait_duration_seconds_bucket{priority_level="catch-all",le="0.1"} 4
+apiserver_flowcontrol_request_wait_duration_seconds_bucket{priority_level="catch-all",le="1"} 6
+apiserver_flowcontrol_request_wait_duration_seconds_bucket{priority_level="catch-all",le="+Inf"} 7
+apiserver_flowcontrol_request_wait_duration_seconds_sum{priority_level="catch-all"} 1.5
+apiserver_flowcontrol_request_wait_duration_seconds_count{priority_level="catch-all"} 7
+`
+
+func sampleData(t *testing.T) realtimedata.RealTimeData {
+	d := realtimedata.RealTimeData{}
+	d.NextGeneration()
+	if err := d.Parse(strings.NewReader(samplePage), nil); err != nil {
+		t.Fatal(err)
+	}
+	return d.Snapshot()
+}
+
+// Stand-in receiver which answers with the statuses in order and 204 after these
+type receiver struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func newReceiver(statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.bodies = append(r.bodies, body)
+		r.headers = append(r.headers, request.Header.Clone())
+		if len(r.statuses) > 0 {
+			status := r.statuses[0]
+			r.statuses = r.statuses[1:]
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return r
+}
+
+func (r *receiver) requests() [][]byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.bodies
+}
+
+func newTestPusher(t *testing.T, cfg config.Sink) *Pusher {
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 500
+	}
+	cfg.Timeout = config.Duration(5 * time.Second)
+	pusher, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pusher
+}
+
+// Series of a remote-write request
+type decodedSeries struct {
+	labels map[string]string
+	names  []string // label names in the order of the request
+	value  float64
+}
+
+func decodeWriteRequest(t *testing.T, body []byte) []decodedSeries {
+	request, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("not snappy: %v", err)
+	}
+	all := []decodedSeries{}
+	for _, timeSeries := range fields(t, request, 1) {
+		s := decodedSeries{labels: make(map[string]string)}
+		for _, label := range fields(t, timeSeries, 1) {
+			name, value := string(fields(t, label, 1)[0]), string(fields(t, label, 2)[0])
+			s.labels[name] = value
+			s.names = append(s.names, name)
+		}
+		sample := fields(t, timeSeries, 2)[0]
+		_, _, n := protowire.ConsumeField(sample)
+		bits, _ := protowire.ConsumeFixed64(sample[protowire.SizeTag(1):n])
+		s.value = math.Float64frombits(bits)
+		all = append(all, s)
+	}
+	return all
+}
+
+// Length delimited fields of a message with the number
+func fields(t *testing.T, message []byte, number protowire.Number) [][]byte {
+	found := [][]byte{}
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			t.Fatalf("invalid protobuf: %v", protowire.ParseError(n))
+		}
+		message = message[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, message)
+			message = message[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(message)
+		if num == number {
+			found = append(found, value)
+		}
+		message = message[n:]
+	}
+	return found
+}
+
+func TestRemoteWrite(t *testing.T) {
+	r := newReceiver()
+	defer r.Close()
+	pusher := newTestPusher(t, config.Sink{Type: "remote_write", URL: r.URL, BatchSize: 2, ExternalLabels: map[string]string{"cluster": "b", "region": "eu"}})
+	if err := pusher.push(context.Background(), sampleData(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := r.requests()
+	if len(requests) != 4 { // 3 gauge and counter series, 3 buckets, sum and count
+		t.Fatalf("expected 4 requests of at most 2 series, got %d", len(requests))
+	}
+	if r.headers[0].Get("Content-Encoding") != "snappy" || r.headers[0].Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("unexpected headers %v", r.headers[0])
+	}
+	all := []decodedSeries{}
+	for _, body := range requests {
+		series := decodeWriteRequest(t, body)
+		if len(series) > 2 {
+			t.Errorf("expected at most 2 series per request, got %d", len(series))
+		}
+		all = append(all, series...)
+	}
+	if len(all) != 8 {
+		t.Fatalf("expected 8 series, got %d", len(all))
+	}
+	for _, s := range all {
+		for i := 1; i < len(s.names); i++ {
+			if s.names[i-1] >= s.names[i] {
+				t.Errorf("labels not sorted: %v", s.names)
+			}
+		}
+		if s.labels["region"] != "eu" {
+			t.Errorf("expected the external label on %v", s.labels)
+		}
+	}
+	if first := all[0]; first.labels["cluster"] != "a" || first.value != 3 {
+		t.Errorf("expected the series label to win over the external label, got %v %v", first.labels, first.value)
+	}
+	if second := all[1]; second.labels["cluster"] != "b" || second.labels["__name__"] != "apiserver_flowcontrol_current_inqueue_requests" {
+		t.Errorf("expected the external label, got %v", second.labels)
+	}
+	if bucket := all[5]; bucket.labels["__name__"] != "apiserver_flowcontrol_request_wait_duration_seconds_bucket" || bucket.labels["le"] != "0.1" || bucket.value != 4 {
+		t.Errorf("unexpected bucket %v %v", bucket.labels, bucket.value)
+	}
+}
+
+func TestOTLP(t *testing.T) {
+	r := newReceiver()
+	defer r.Close()
+	pusher := newTestPusher(t, config.Sink{Type: "otlp", URL: r.URL, BatchSize: 2, ExternalLabels: map[string]string{"cluster": "b"}})
+	if err := pusher.push(context.Background(), sampleData(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	type exportRequest struct {
+		ResourceMetrics []struct {
+			Resource     struct{ Attributes []otlpAttribute }
+			ScopeMetrics []struct{ Metrics []otlpMetric }
+		}
+	}
+	requests := []exportRequest{}
+	for _, body := range r.requests() {
+		var request exportRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Fatalf("invalid JSON %s: %v", body, err)
+		}
+		requests = append(requests, request)
+	}
+	if len(requests) != 2 { // 4 data points
+		t.Fatalf("expected 2 requests of at most 2 data points, got %d", len(requests))
+	}
+	metrics := []otlpMetric{}
+	for _, request := range requests {
+		resource := request.ResourceMetrics[0].Resource.Attributes
+		if len(resource) != 1 || resource[0].Key != "cluster" || resource[0].Value.StringValue != "b" {
+			t.Errorf("expected the external labels as resource attributes, got %+v", resource)
+		}
+		metrics = append(metrics, request.ResourceMetrics[0].ScopeMetrics[0].Metrics...)
+	}
+
+	gauge := metrics[0].Gauge
+	if gauge == nil || len(gauge.DataPoints) != 2 || *gauge.DataPoints[0].AsDouble != 3 {
+		t.Fatalf("unexpected gauge %+v", metrics[0])
+	}
+	if attributes := gauge.DataPoints[0].Attributes; attributes[0].Key != "cluster" || attributes[0].Value.StringValue != "a" {
+		t.Errorf("expected the series label on the data point, got %+v", attributes)
+	}
+	if sum := metrics[1].Sum; sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != cumulative {
+		t.Errorf("expected a monotonic cumulative sum, got %+v", metrics[1])
+	}
+	histogram := metrics[2].Histogram
+	if histogram == nil {
+		t.Fatalf("expected a histogram, got %+v", metrics[2])
+	}
+	point := histogram.DataPoints[0]
+	if strings.Join(point.BucketCounts, ",") != "4,2,1" || len(point.ExplicitBounds) != 2 || point.Count != "7" || *point.Sum != 1.5 {
+		t.Errorf("unexpected histogram data point %+v", point)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	for _, test := range []struct {
+		statuses []int
+		requests int
+		fails    bool
+	}{
+		{statuses: []int{500, 503}, requests: 3},
+		{statuses: []int{429}, requests: 2},
+		{statuses: []int{400}, requests: 1, fails: true},
+		{statuses: []int{401}, requests: 1, fails: true},
+		{statuses: []int{500, 502, 503}, requests: 3, fails: true},
+	} {
+		r := newReceiver(test.statuses...)
+		pusher := newTestPusher(t, config.Sink{Type: "remote_write", URL: r.URL, MaxRetries: 2})
+		err := pusher.push(context.Background(), sampleData(t))
+		if (err != nil) != test.fails {
+			t.Errorf("%v: unexpected error %v", test.statuses, err)
+		}
+		if n := len(r.requests()); n != test.requests {
+			t.Errorf("%v: expected %d requests, got %d", test.statuses, test.requests, n)
+		}
+		r.Close()
+	}
+}
+
+const taggedPage = `# TYPE http_requests_total counter
+http_requests_total{code="2,0",path="/x y=z",cluster="a",empty=""} 4
+http_requests_total{code="500",path="/"} NaN
+`
+
+func encodeLines(t *testing.T, s Sink, batchSize int) []string {
+	d := realtimedata.RealTimeData{}
+	d.NextGeneration()
+	if err := d.Parse(strings.NewReader(taggedPage), nil); err != nil {
+		t.Fatal(err)
+	}
+	d.Time = time.Unix(1700000000, 0)
+	bodies, err := s.Encode(d.Snapshot(), batchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{}
+	for _, body := range bodies {
+		lines = append(lines, string(body))
+	}
+	return lines
+}
+
+func TestInfluxEncode(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config config.Sink
+		want   string
+	}{
+		{"all labels", config.Sink{}, `http_requests_total,cluster=a,code=2\,0,path=/x\ y\=z value=4 1700000000000000000` + "\n"},
+		{"prefix and separator", config.Sink{Prefix: "k8s.", NameSeparator: "."}, `k8s.http.requests.total,cluster=a,code=2\,0,path=/x\ y\=z value=4 1700000000000000000` + "\n"},
+		{"tags", config.Sink{Tags: map[string]string{"code": "status"}}, `http_requests_total,status=2\,0 value=4 1700000000000000000` + "\n"},
+		{"external labels", config.Sink{ExternalLabels: map[string]string{"cluster": "b", "region": "eu"}, Tags: map[string]string{"cluster": "cluster"}}, `http_requests_total,cluster=a,region=eu value=4 1700000000000000000` + "\n"},
+	} {
+		lines := encodeLines(t, &influx{mapping: newMapping(test.config)}, 10)
+		if len(lines) != 1 || lines[0] != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, lines)
+		}
+	}
+}
+
+func TestGraphiteEncode(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config config.Sink
+		want   string
+	}{
+		{"all labels", config.Sink{}, "http_requests_total;cluster=a;code=2,0;path=/x_y_z 4 1700000000\n"},
+		{"prefix and separator", config.Sink{Prefix: "k8s.", NameSeparator: "."}, "k8s.http.requests.total;cluster=a;code=2,0;path=/x_y_z 4 1700000000\n"},
+		{"tags", config.Sink{Tags: map[string]string{"path": "handler"}}, "http_requests_total;handler=/x_y_z 4 1700000000\n"},
+		{"external labels", config.Sink{ExternalLabels: map[string]string{"cluster": "b"}}, "http_requests_total;cluster=a;code=2,0;path=/x_y_z 4 1700000000\n"},
+	} {
+		lines := encodeLines(t, &graphite{mapping: newMapping(test.config)}, 10)
+		if len(lines) != 1 || lines[0] != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, lines)
+		}
+	}
+}
+
+func TestEncodeBatches(t *testing.T) {
+	d := sampleData(t) // 8 series
+	for _, s := range []Sink{&influx{}, &graphite{}} {
+		bodies, err := s.Encode(d, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bodies) != 3 || strings.Count(string(bodies[2]), "\n") != 2 {
+			t.Errorf("%T: expected batches of 3, 3 and 2 lines, got %q", s, bodies)
+		}
+	}
+}
+
+func TestSocketSend(t *testing.T) {
+	long := "long_metric;tag=" + strings.Repeat("x", maxDatagramSize) + " 1 1700000000\n"
+	body := []byte(strings.Repeat("short_metric 1 1700000000\n", 100) + long + "last_metric 2 1700000000\n")
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	udp := &socketSender{network: "udp", address: conn.LocalAddr().String()}
+	if err := udp.send(context.Background(), body); err != nil {
+		t.Fatal(err)
+	}
+	var received []byte
+	buffer := make([]byte, 64*1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(received) < len(body) {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("received %d of %d bytes: %v", len(received), len(body), err)
+		}
+		datagram := string(buffer[:n])
+		if !strings.HasSuffix(datagram, "\n") {
+			t.Errorf("datagram not split at a line: %q", datagram)
+		}
+		if n > maxDatagramSize && datagram != long {
+			t.Errorf("datagram of %d bytes with more than the long line", n)
+		}
+		received = append(received, datagram...)
+	}
+	if string(received) != string(body) {
+		t.Errorf("the datagrams don't add up to the body")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	done := make(chan []byte)
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			done <- nil
+			return
+		}
+		defer c.Close()
+		b, _ := io.ReadAll(c)
+		done <- b
+	}()
+	pusher := newTestPusher(t, config.Sink{Type: "graphite", URL: "tcp://" + listener.Addr().String()})
+	if err := pusher.sink.Send(context.Background(), body); err != nil {
+		t.Fatal(err)
+	}
+	if b := <-done; string(b) != string(body) {
+		t.Errorf("expected the body over TCP, got %d bytes", len(b))
+	}
+}
@@ -0,0 +1,226 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// OTLP/HTTP with the JSON encoding of an ExportMetricsServiceRequest,
+// the external labels are the attributes of the resource
+type otlp struct {
+	sender         *httpSender
+	externalLabels map[string]string
+}
+
+var otlpHeader = http.Header{"Content-Type": {"application/json"}}
+
+// Aggregation temporality of counters and histograms which count since the start of the process
+const cumulative = 2
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes     []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	AsDouble       *float64        `json:"asDouble,omitempty"`
+	Count          string          `json:"count,omitempty"`
+	Sum            *float64        `json:"sum,omitempty"`
+	BucketCounts   []string        `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64       `json:"explicitBounds,omitempty"`
+	QuantileValues []otlpQuantile  `json:"quantileValues,omitempty"`
+}
+
+type otlpData struct {
+	AggregationTemporality int             `json:"aggregationTemporality,omitempty"`
+	IsMonotonic            bool            `json:"isMonotonic,omitempty"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Gauge       *otlpData `json:"gauge,omitempty"`
+	Sum         *otlpData `json:"sum,omitempty"`
+	Histogram   *otlpData `json:"histogram,omitempty"`
+	Summary     *otlpData `json:"summary,omitempty"`
+}
+
+func (o *otlp) Encode(data realtimedata.RealTimeData, batchSize int) ([][]byte, error) {
+	timestamp := strconv.FormatInt(data.Time.UnixNano(), 10)
+	bodies := [][]byte{}
+	batch := []otlpMetric{}
+	points := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		body, err := json.Marshal(o.request(batch))
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, body)
+		batch, points = []otlpMetric{}, 0
+		return nil
+	}
+
+	for _, metric := range data.Metrics {
+		dataPoints := otlpDataPoints(metric, data.Generation, timestamp)
+		for len(dataPoints) > 0 {
+			n := min(batchSize-points, len(dataPoints))
+			batch = append(batch, newOTLPMetric(metric, dataPoints[:n]))
+			dataPoints = dataPoints[n:]
+			if points += n; points >= batchSize {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return bodies, nil
+}
+
+func (o *otlp) request(metrics []otlpMetric) interface{} {
+	names := make([]string, 0, len(o.externalLabels))
+	for name := range o.externalLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resource := []otlpAttribute{}
+	for _, name := range names {
+		resource = append(resource, newAttribute(name, o.externalLabels[name]))
+	}
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": resource},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]interface{}{"name": "metrics-viewer"},
+				"metrics": metrics,
+			}},
+		}},
+	}
+}
+
+func newOTLPMetric(metric realtimedata.RealTimeDataMetric, dataPoints []otlpDataPoint) otlpMetric {
+	m := otlpMetric{Name: metric.Name, Description: metric.Description}
+	switch metric.Type {
+	case "counter":
+		m.Sum = &otlpData{AggregationTemporality: cumulative, IsMonotonic: true, DataPoints: dataPoints}
+	case "histogram":
+		m.Histogram = &otlpData{AggregationTemporality: cumulative, DataPoints: dataPoints}
+	case "summary":
+		m.Summary = &otlpData{DataPoints: dataPoints}
+	default:
+		m.Gauge = &otlpData{DataPoints: dataPoints}
+	}
+	return m
+}
+
+// Data points of the current series of a metric, the quantiles of a summary are joined with its sum and count
+func otlpDataPoints(metric realtimedata.RealTimeDataMetric, generation int, timestamp string) []otlpDataPoint {
+	dataPoints := []otlpDataPoint{}
+	summaries := make(map[string]int) // labels without quantile -> index in dataPoints
+	for _, value := range metric.Values {
+		if value.LastSeen != generation {
+			continue
+		}
+		v, err := strconv.ParseFloat(value.Value, 64)
+		if err != nil {
+			continue
+		}
+		switch metric.Type {
+		case "histogram":
+			point := otlpDataPoint{Attributes: attributes(value.Labels, ""), TimeUnixNano: timestamp, Count: countString(value.Count), Sum: &v}
+			var previous float64
+			for _, bucket := range value.Buckets {
+				if !math.IsInf(bucket.UpperBound, 1) {
+					point.ExplicitBounds = append(point.ExplicitBounds, bucket.UpperBound)
+				}
+				point.BucketCounts = append(point.BucketCounts, strconv.FormatFloat(bucket.Count-previous, 'f', 0, 64))
+				previous = bucket.Count
+			}
+			dataPoints = append(dataPoints, point)
+		case "summary":
+			key := labelKey(value.Labels, "quantile")
+			i, ok := summaries[key]
+			if !ok {
+				i = len(dataPoints)
+				summaries[key] = i
+				dataPoints = append(dataPoints, otlpDataPoint{Attributes: attributes(value.Labels, "quantile"), TimeUnixNano: timestamp})
+			}
+			quantile := ""
+			for _, l := range value.Labels {
+				if l.Label == "quantile" {
+					quantile = l.Value
+				}
+			}
+			if q, err := strconv.ParseFloat(quantile, 64); err == nil {
+				dataPoints[i].QuantileValues = append(dataPoints[i].QuantileValues, otlpQuantile{Quantile: q, Value: v})
+			} else { // the _sum and _count series
+				dataPoints[i].Sum = &v
+				dataPoints[i].Count = countString(value.Count)
+			}
+		default:
+			dataPoints = append(dataPoints, otlpDataPoint{Attributes: attributes(value.Labels, ""), TimeUnixNano: timestamp, AsDouble: &v})
+		}
+	}
+	return dataPoints
+}
+
+func attributes(labels []realtimedata.RealTimeDataMetricLabel, skip string) []otlpAttribute {
+	attributes := []otlpAttribute{}
+	for _, l := range labels {
+		if l.Label != skip {
+			attributes = append(attributes, newAttribute(l.Label, l.Value))
+		}
+	}
+	return attributes
+}
+
+func newAttribute(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+func labelKey(labels []realtimedata.RealTimeDataMetricLabel, skip string) string {
+	var builder strings.Builder
+	for _, l := range labels {
+		if l.Label != skip {
+			builder.WriteString(l.Label + "\x00" + l.Value + "\x00")
+		}
+	}
+	return builder.String()
+}
+
+// Count as an uint64 string, counts are written as floats in the text format
+func countString(count string) string {
+	c, err := strconv.ParseFloat(count, 64)
+	if err != nil || c < 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(c, 'f', 0, 64)
+}
+
+func (o *otlp) Send(ctx context.Context, body []byte) error {
+	return o.sender.post(ctx, body, otlpHeader)
+}
@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"context"
+	"math"
+	"net/http"
+
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Prometheus remote-write 1.0: a snappy compressed protobuf WriteRequest
+type remoteWrite struct {
+	sender         *httpSender
+	externalLabels map[string]string
+}
+
+var remoteWriteHeader = http.Header{
+	"Content-Type":                      {"application/x-protobuf"},
+	"Content-Encoding":                  {"snappy"},
+	"X-Prometheus-Remote-Write-Version": {"0.1.0"},
+}
+
+func (r *remoteWrite) Encode(data realtimedata.RealTimeData, batchSize int) ([][]byte, error) {
+	all := flatten(data, r.externalLabels)
+	timestamp := data.Time.UnixMilli()
+	bodies := [][]byte{}
+	for start := 0; start < len(all); start += batchSize {
+		var request []byte
+		for _, s := range all[start:min(start+batchSize, len(all))] {
+			request = protowire.AppendTag(request, 1, protowire.BytesType) // WriteRequest.timeseries
+			request = protowire.AppendBytes(request, encodeTimeSeries(s, timestamp))
+		}
+		bodies = append(bodies, snappy.Encode(nil, request))
+	}
+	return bodies, nil
+}
+
+// TimeSeries with the labels sorted by name, including __name__, and one sample
+func encodeTimeSeries(s series, timestamp int64) []byte {
+	labels := append([]realtimedata.RealTimeDataMetricLabel{{Label: "__name__", Value: s.name}}, s.labels...)
+	var timeSeries []byte
+	for _, l := range sortLabels(labels) {
+		timeSeries = appendLabel(timeSeries, l.Label, l.Value)
+	}
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type) // Sample.value
+	sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType) // Sample.timestamp
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+	timeSeries = protowire.AppendTag(timeSeries, 2, protowire.BytesType) // TimeSeries.samples
+	return protowire.AppendBytes(timeSeries, sample)
+}
+
+func appendLabel(b []byte, name, value string) []byte {
+	var label []byte
+	label = protowire.AppendTag(label, 1, protowire.BytesType) // Label.name
+	label = protowire.AppendString(label, name)
+	label = protowire.AppendTag(label, 2, protowire.BytesType) // Label.value
+	label = protowire.AppendString(label, value)
+	b = protowire.AppendTag(b, 1, protowire.BytesType) // TimeSeries.labels
+	return protowire.AppendBytes(b, label)
+}
+
+func (r *remoteWrite) Send(ctx context.Context, body []byte) error {
+	return r.sender.post(ctx, body, remoteWriteHeader)
+}
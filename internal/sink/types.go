@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// Protocol to push the scraped series with
+type Sink interface {
+	// Encode the series of the last scrape in request bodies of at most batchSize series
+	Encode(data realtimedata.RealTimeData, batchSize int) ([][]byte, error)
+	// Send one request body, a permanent error isn't retried
+	Send(ctx context.Context, body []byte) error
+}
+
+// Pushes the scrapes to a sink in the background with retries
+type Pusher struct {
+	config config.Sink
+	sink   Sink
+	queue  chan realtimedata.RealTimeData
+}
+
+// A series of the Prometheus text format, histograms and summaries are split in their _sum, _count and _bucket series
+type series struct {
+	name   string
+	labels []realtimedata.RealTimeDataMetricLabel // sorted by name, with the external labels
+	value  float64
+}
+
+// Sends request bodies to a HTTP endpoint
+type httpSender struct {
+	url    string
+	header http.Header
+	client *http.Client
+}
+
+// Error which won't go away by retrying, like a rejected request
+type permanentError struct {
+	err error
+}
+
+// Sends request bodies over TCP or UDP, over UDP the lines are sent in datagrams of at most maxDatagramSize bytes
+type socketSender struct {
+	network string
+	address string
+}
+
+// Metric names and tags of the sinks without Prometheus labels
+type mapping struct {
+	prefix         string
+	separator      string            // replaces the _ in names if set
+	tags           map[string]string // label -> tag name, empty keeps all labels
+	externalLabels map[string]string // always sent as tags
+}
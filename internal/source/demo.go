@@ -0,0 +1,201 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+const (
+	demoRestartEvery = 300 // scrapes between restarts of the demo apiserver
+	demoJobLifetime  = 40  // scrapes a flow schema of a batch job lives
+)
+
+var demoLevels = []demoLevel{
+	{"exempt", 0, []string{"exempt"}},
+	{"system", 74, []string{"system-nodes", "system-node-high"}},
+	{"leader-election", 25, []string{"system-leader-election", "kube-controller-manager"}},
+	{"workload-high", 98, []string{"kube-scheduler", "kube-system-service-accounts"}},
+	{"workload-low", 245, []string{"service-accounts"}},
+	{"global-default", 49, []string{"global-default"}},
+	{"catch-all", 13, []string{"catch-all"}},
+}
+
+var (
+	demoWaitBuckets = []float64{0, 0.005, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10, 15, 30}
+	demoQuantiles   = []string{"0", "0.25", "0.5", "0.75", "1"}
+)
+
+// Create a demo source, the same seed generates the same scrapes
+func NewDemo(seed int64, appConfig config.ApplicationConfig) *Demo {
+	d := &Demo{random: rand.New(rand.NewSource(seed)), evictStaleAfter: appConfig.Settings.EvictStaleAfter}
+	d.restart()
+	return d
+}
+
+func (d *Demo) restart() {
+	d.counters = make(map[string]float64)
+	d.histograms = make(map[string][]float64)
+	d.sums = make(map[string]float64)
+}
+
+func (d *Demo) Scrape() (realtimedata.RealTimeData, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.data.NextGeneration()
+	if err := d.data.Parse(bytes.NewReader(d.next()), nil); err != nil {
+		return realtimedata.RealTimeData{}, err
+	}
+	d.data.EvictStale(d.evictStaleAfter)
+	return d.data.Snapshot(), nil
+}
+
+// Metrics page of the next scrape in the text format, like a GET of /metrics
+func (d *Demo) Page() []byte {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.next()
+}
+
+func (d *Demo) next() []byte {
+	d.scrape++
+	if d.scrape%demoRestartEvery == 0 {
+		d.restart()
+	}
+	var page bytes.Buffer
+	load := d.load()
+
+	family(&page, "apiserver_flowcontrol_nominal_limit_seats", "gauge", "Nominal number of execution seats configured for each priority level")
+	for _, level := range demoLevels {
+		fmt.Fprintf(&page, "apiserver_flowcontrol_nominal_limit_seats{priority_level=%q} %g\n", level.name, level.seats)
+	}
+	family(&page, "apiserver_flowcontrol_current_limit_seats", "gauge", "current derived number of execution seats available to each priority level")
+	for _, level := range demoLevels {
+		borrowed := math.Round(level.seats * 0.3 * (load - 0.5))
+		fmt.Fprintf(&page, "apiserver_flowcontrol_current_limit_seats{priority_level=%q} %g\n", level.name, math.Max(level.seats+borrowed, 0))
+	}
+
+	family(&page, "apiserver_flowcontrol_current_inqueue_requests", "gauge", "Number of requests currently pending in queues of the API Priority and Fairness subsystem")
+	for _, level := range demoLevels {
+		for _, schema := range d.schemas(level) {
+			queued := 0.0
+			if level.seats > 0 && load > 0.7 {
+				queued = math.Floor(d.random.Float64() * level.seats * (load - 0.7))
+			}
+			fmt.Fprintf(&page, "apiserver_flowcontrol_current_inqueue_requests{flow_schema=%q,priority_level=%q} %g\n", schema, level.name, queued)
+		}
+	}
+	family(&page, "apiserver_flowcontrol_current_executing_seats", "gauge", "Concurrency (number of seats) occupied by the currently executing requests in the API Priority and Fairness subsystem")
+	for _, level := range demoLevels {
+		for _, schema := range d.schemas(level) {
+			fmt.Fprintf(&page, "apiserver_flowcontrol_current_executing_seats{flow_schema=%q,priority_level=%q} %g\n", schema, level.name, math.Floor(d.random.Float64()*math.Max(level.seats, 5)*load))
+		}
+	}
+
+	family(&page, "apiserver_flowcontrol_dispatched_requests_total", "counter", "Number of requests executed by API Priority and Fairness subsystem")
+	for _, level := range demoLevels {
+		for _, schema := range d.schemas(level) {
+			series := fmt.Sprintf("{flow_schema=%q,priority_level=%q}", schema, level.name)
+			d.counters["dispatched"+series] += math.Floor(d.random.Float64() * 50 * load)
+			fmt.Fprintf(&page, "apiserver_flowcontrol_dispatched_requests_total%s %g\n", series, d.counters["dispatched"+series])
+		}
+	}
+	family(&page, "apiserver_flowcontrol_rejected_requests_total", "counter", "Number of requests rejected by API Priority and Fairness subsystem")
+	for _, level := range demoLevels[1:] {
+		for _, schema := range d.schemas(level) {
+			for _, reason := range []string{"queue-full", "time-out"} {
+				series := fmt.Sprintf("{flow_schema=%q,priority_level=%q,reason=%q}", schema, level.name, reason)
+				if load > 0.9 {
+					d.counters["rejected"+series] += math.Floor(d.random.Float64() * 10)
+				}
+				if _, ok := d.counters["rejected"+series]; ok { // rejected requests only appear after the first rejection
+					fmt.Fprintf(&page, "apiserver_flowcontrol_rejected_requests_total%s %g\n", series, d.counters["rejected"+series])
+				}
+			}
+		}
+	}
+
+	family(&page, "apiserver_flowcontrol_request_wait_duration_seconds", "histogram", "Length of time a request spent waiting in its queue")
+	for _, level := range demoLevels {
+		for _, schema := range d.schemas(level) {
+			series := fmt.Sprintf("execute=%q,flow_schema=%q,priority_level=%q", "true", schema, level.name)
+			d.observe(series, demoWaitBuckets, 10, 0.002+0.5*math.Pow(load, 4))
+			d.writeHistogram(&page, "apiserver_flowcontrol_request_wait_duration_seconds", series, demoWaitBuckets)
+		}
+	}
+
+	family(&page, "go_gc_duration_seconds", "summary", "A summary of the pause duration of garbage collection cycles.")
+	cycles := float64(1 + d.random.Intn(3))
+	d.counters["gc"] += cycles
+	d.sums["gc"] += cycles * 0.0003 * (1 + d.random.Float64())
+	for i, q := range demoQuantiles {
+		fmt.Fprintf(&page, "go_gc_duration_seconds{quantile=%q} %g\n", q, 0.00002*math.Pow(3, float64(i))*(1+d.random.Float64()))
+	}
+	fmt.Fprintf(&page, "go_gc_duration_seconds_sum %g\ngo_gc_duration_seconds_count %g\n", d.sums["gc"], d.counters["gc"])
+	return page.Bytes()
+}
+
+// Load between 0 and 1 in waves of a few minutes with noise and spikes
+func (d *Demo) load() float64 {
+	load := 0.45 + 0.3*math.Sin(float64(d.scrape)/40) + 0.1*d.random.Float64()
+	if d.random.Intn(60) == 0 {
+		load += 0.5
+	}
+	return math.Min(math.Max(load, 0), 1)
+}
+
+// Flow schemas of a priority level, the workload-low level has batch jobs which come and go
+func (d *Demo) schemas(level demoLevel) []string {
+	if level.name != "workload-low" {
+		return level.schemas
+	}
+	job := d.scrape / demoJobLifetime
+	return append(level.schemas[:len(level.schemas):len(level.schemas)], "batch-job-"+strconv.Itoa(job), "batch-job-"+strconv.Itoa(job+1))
+}
+
+// Add up to max observations with exponentially distributed values of the mean to a histogram
+func (d *Demo) observe(series string, bounds []float64, max int, mean float64) {
+	counts, ok := d.histograms[series]
+	if !ok {
+		counts = make([]float64, len(bounds)+1)
+		d.histograms[series] = counts
+	}
+	for n := d.random.Intn(max + 1); n > 0; n-- {
+		v := d.random.ExpFloat64() * mean
+		d.sums[series] += v
+		for i, bound := range bounds {
+			if v <= bound {
+				counts[i]++
+			}
+		}
+		counts[len(bounds)]++
+	}
+}
+
+func (d *Demo) writeHistogram(page *bytes.Buffer, name, series string, bounds []float64) {
+	counts := d.histograms[series]
+	for i, bound := range bounds {
+		fmt.Fprintf(page, "%s_bucket{%s,le=%q} %g\n", name, series, strconv.FormatFloat(bound, 'g', -1, 64), counts[i])
+	}
+	fmt.Fprintf(page, "%s_bucket{%s,le=\"+Inf\"} %g\n", name, series, counts[len(bounds)])
+	fmt.Fprintf(page, "%s_sum{%s} %g\n%s_count{%s} %g\n", name, series, d.sums[series], name, series, counts[len(bounds)])
+}
+
+func family(page *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(page, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func (d *Demo) SetConfig(config config.ApplicationConfig) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.evictStaleAfter = config.Settings.EvictStaleAfter
+}
+
+func (d *Demo) String() string {
+	return "demo"
+}
@@ -0,0 +1,177 @@
+package source
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	httpTimeout = 30 * time.Second
+	// the text format, endpoints which also speak protobuf or OpenMetrics negotiate
+	acceptHeader = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+)
+
+// Create a source for a target, credentials in the url are used for basic auth
+func NewHTTP(target config.Target, appConfig config.ApplicationConfig) (*HTTP, error) {
+	h := &HTTP{configured: target, evictStaleAfter: appConfig.Settings.EvictStaleAfter}
+	if err := h.setTarget(target); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Use the url, credentials and TLS settings of a target
+func (h *HTTP) setTarget(target config.Target) error {
+	if errs := config.ValidateTarget("target", target); len(errs) > 0 {
+		return errs[0]
+	}
+	u, _ := url.Parse(target.URL)
+	if u.User != nil && target.Username == "" {
+		target.Username = u.User.Username()
+		target.Password, _ = u.User.Password()
+		u.User = nil
+		target.URL = u.String()
+	}
+	for _, file := range []*string{&target.PasswordFile, &target.BearerTokenFile, &target.CAFile, &target.CertFile, &target.KeyFile} {
+		*file, _ = homedir.Expand(*file)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: target.InsecureSkipVerify}
+	if target.CAFile != "" {
+		ca, err := os.ReadFile(target.CAFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificates found in %s", target.CAFile)
+		}
+	}
+	if target.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(target.CertFile, target.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	h.target = target
+	h.client = &http.Client{Transport: transport, Timeout: httpTimeout}
+	return nil
+}
+
+// Fetch the endpoint, the page is parsed while it is read without the lock and merged with the lock,
+// so a slow endpoint doesn't hold up reloads
+func (h *HTTP) Scrape() (realtimedata.RealTimeData, error) {
+	h.mutex.Lock()
+	request, err := h.request()
+	client := h.client
+	h.mutex.Unlock()
+	if err != nil {
+		return realtimedata.RealTimeData{}, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return realtimedata.RealTimeData{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return realtimedata.RealTimeData{}, fmt.Errorf("unable to get metrics data http error %s", response.Status)
+	}
+	page := realtimedata.RealTimeData{}
+	if err := page.Parse(response.Body, nil); err != nil {
+		return realtimedata.RealTimeData{}, err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.data.NextGeneration()
+	h.data.Merge(page)
+	h.data.EvictStale(h.evictStaleAfter)
+	return h.data.Snapshot(), nil
+}
+
+func (h *HTTP) request() (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodGet, h.target.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", acceptHeader)
+	return request, h.authorize(request)
+}
+
+// Add the headers and the credentials of the target, the password and token files are read every time
+func (h *HTTP) authorize(request *http.Request) error {
+	for name, value := range h.target.Headers {
+		request.Header.Set(name, value)
+	}
+	if h.target.Username != "" {
+		password := h.target.Password
+		if h.target.PasswordFile != "" {
+			var err error
+			if password, err = readSecret(h.target.PasswordFile); err != nil {
+				return err
+			}
+		}
+		request.SetBasicAuth(h.target.Username, password)
+	}
+	if h.target.BearerTokenFile != "" {
+		token, err := readSecret(h.target.BearerTokenFile)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// Apply a reloaded config, a changed entry of a --target is used for the next scrapes
+func (h *HTTP) SetConfig(config config.ApplicationConfig) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.evictStaleAfter = config.Settings.EvictStaleAfter
+	if h.target.Name == "" {
+		return
+	}
+	target, ok := config.Target(h.target.Name)
+	if !ok || reflect.DeepEqual(target, h.configured) {
+		return
+	}
+	if err := h.setTarget(target); err != nil {
+		logrus.Warnf("Target %s not changed: %v", target.Name, err)
+		return
+	}
+	h.configured = target
+}
+
+// Name of the target or its url
+func (h *HTTP) String() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.target.Name != "" {
+		return h.target.Name
+	}
+	return h.target.URL
+}
+
+func readSecret(filename string) (string, error) {
+	secret, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
@@ -0,0 +1,71 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+// Create a source for a dump or a directory of dumps
+func NewFile(path string, config config.ApplicationConfig) (*File, error) {
+	f := &File{path: path, evictStaleAfter: config.Settings.EvictStaleAfter}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return f, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			f.files = append(f.files, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(f.files) == 0 {
+		return nil, fmt.Errorf("%s has no dumps", path)
+	}
+	sort.Strings(f.files)
+	return f, nil
+}
+
+// Read the file again or the next dump, the last dump of a directory is read again when the replay is done
+func (f *File) Scrape() (realtimedata.RealTimeData, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	filename := f.path
+	if f.files != nil {
+		filename = f.files[f.next]
+		if f.next < len(f.files)-1 {
+			f.next++
+		}
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return realtimedata.RealTimeData{}, err
+	}
+	defer file.Close()
+	f.data.NextGeneration()
+	if err := f.data.Parse(file, nil); err != nil {
+		return realtimedata.RealTimeData{}, fmt.Errorf("%s: %v", filename, err)
+	}
+	f.data.EvictStale(f.evictStaleAfter)
+	return f.data.Snapshot(), nil
+}
+
+func (f *File) SetConfig(config config.ApplicationConfig) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.evictStaleAfter = config.Settings.EvictStaleAfter
+}
+
+func (f *File) String() string {
+	return "file " + f.path
+}
@@ -0,0 +1,266 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+)
+
+func findMetric(data realtimedata.RealTimeData, name string) *realtimedata.RealTimeDataMetric {
+	for i := range data.Metrics {
+		if data.Metrics[i].Name == name {
+			return &data.Metrics[i]
+		}
+	}
+	return nil
+}
+
+func TestDemoPages(t *testing.T) {
+	a, b := NewDemo(42, config.ApplicationConfig{}), NewDemo(42, config.ApplicationConfig{})
+	for i := 0; i < 5; i++ {
+		if !bytes.Equal(a.Page(), b.Page()) {
+			t.Fatalf("page %d differs for the same seed", i+1)
+		}
+	}
+}
+
+func TestDemo(t *testing.T) {
+	cfg := config.ApplicationConfig{}
+	cfg.Settings.EvictStaleAfter = 2
+	d := NewDemo(1, cfg)
+
+	var data realtimedata.RealTimeData
+	var err error
+	jobs := make(map[string]bool) // batch job flow schemas seen
+	previous := 0.0
+	reset := false
+	for i := 1; i <= demoRestartEvery; i++ {
+		if data, err = d.Scrape(); err != nil {
+			t.Fatal(err)
+		}
+		dispatched := findMetric(data, "apiserver_flowcontrol_dispatched_requests_total")
+		for _, v := range dispatched.Values {
+			for _, l := range v.Labels {
+				if l.Label == "flow_schema" && len(l.Value) > 10 && l.Value[:10] == "batch-job-" {
+					jobs[l.Value] = true
+				}
+			}
+		}
+		value, _ := strconv.ParseFloat(dispatched.Values[0].Value, 64)
+		reset = reset || value < previous
+		previous = value
+	}
+
+	types := map[string]string{
+		"apiserver_flowcontrol_current_limit_seats":           "gauge",
+		"apiserver_flowcontrol_rejected_requests_total":       "counter",
+		"apiserver_flowcontrol_request_wait_duration_seconds": "histogram",
+		"go_gc_duration_seconds":                              "summary",
+	}
+	for name, metricType := range types {
+		if m := findMetric(data, name); m == nil || m.Type != metricType {
+			t.Errorf("expected %s to be a %s, got %+v", name, metricType, m)
+		}
+	}
+	wait := findMetric(data, "apiserver_flowcontrol_request_wait_duration_seconds")
+	if v := wait.Values[0]; len(v.Buckets) != len(demoWaitBuckets)+1 || v.Count == "" {
+		t.Errorf("expected the buckets and count with the histogram, got %+v", v)
+	}
+	if gc := findMetric(data, "go_gc_duration_seconds"); len(gc.Values) != len(demoQuantiles)+1 {
+		t.Errorf("expected the quantiles and the sum of the summary, got %d values", len(gc.Values))
+	}
+
+	if len(jobs) < demoRestartEvery/demoJobLifetime {
+		t.Errorf("expected the batch jobs to come and go, saw %d", len(jobs))
+	}
+	current := 0
+	for _, v := range findMetric(data, "apiserver_flowcontrol_dispatched_requests_total").Values {
+		for _, l := range v.Labels {
+			if l.Label == "flow_schema" && len(l.Value) > 10 && l.Value[:10] == "batch-job-" {
+				current++
+			}
+		}
+	}
+	if current != 2 {
+		t.Errorf("expected the stale batch jobs to be evicted, got %d", current)
+	}
+	if !reset {
+		t.Error("expected a counter reset at the restart")
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	for i, value := range []string{"1", "5"} {
+		page := fmt.Sprintf("# TYPE x gauge\nx{a=\"1\"} %s\n", value)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.prom", i)), []byte(page), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := NewFile(dir, config.ApplicationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []string{"1", "5", "5"} { // the last dump stays
+		data, err := f.Scrape()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := data.Metrics[0].Values[0].Value; v != expected {
+			t.Errorf("scrape %d: expected %s, got %s", i+1, expected, v)
+		}
+	}
+	if _, err := NewFile(t.TempDir(), config.ApplicationConfig{}); err == nil {
+		t.Error("expected an error for a directory without dumps")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" || r.Header.Get("X-Org") != "a" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintln(w, "# TYPE up gauge\nup 1")
+	}))
+	defer server.Close()
+
+	password := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(password, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHTTP(config.Target{URL: server.URL, Username: "admin", PasswordFile: password, Headers: map[string]string{"X-Org": "a"}}, config.ApplicationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := h.Scrape(); err != nil || len(data.Metrics) != 1 {
+		t.Errorf("expected the up metric, got %+v %v", data.Metrics, err)
+	}
+	h, _ = NewHTTP(config.Target{URL: server.URL}, config.ApplicationConfig{})
+	if _, err := h.Scrape(); err == nil {
+		t.Error("expected an error without credentials")
+	}
+	if _, err := NewHTTP(config.Target{URL: "ftp://host"}, config.ApplicationConfig{}); err == nil {
+		t.Error("expected an error for another scheme than http or https")
+	}
+}
+
+func TestHTTPReload(t *testing.T) {
+	page := func(metric string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "# TYPE %s gauge\n%s 1\n", metric, metric)
+		}))
+	}
+	before, after := page("before"), page("after")
+	defer before.Close()
+	defer after.Close()
+
+	h, err := NewHTTP(config.Target{Name: "node", URL: before.URL}, config.ApplicationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.ApplicationConfig{Targets: []config.Target{{Name: "node", URL: after.URL}}}
+	h.SetConfig(cfg)
+	if data, err := h.Scrape(); err != nil || findMetric(data, "after") == nil {
+		t.Errorf("expected the changed target to be scraped, got %+v %v", data.Metrics, err)
+	}
+	cfg.Targets[0].URL = "ftp://host"
+	h.SetConfig(cfg)
+	if data, err := h.Scrape(); err != nil || findMetric(data, "after") == nil {
+		t.Errorf("expected an invalid target to be ignored, got %+v %v", data.Metrics, err)
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	var metadataRequests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.URL.Path == "/api/v1/metadata" && r.Form.Get("metric") == "wait":
+			metadataRequests.Add(1)
+			fmt.Fprint(w, `{"status":"success","data":{"wait":[{"type":"histogram","help":"Wait"}]}}`)
+		case r.URL.Path == "/api/v1/metadata" && r.Form.Get("metric") != "":
+			metadataRequests.Add(1)
+			fmt.Fprint(w, `{"status":"success","data":{}}`)
+		case r.URL.Path == "/api/v1/query" && r.Form.Get("query") == "sum(up)":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"3"]}]}}`)
+		case r.URL.Path == "/api/v1/query":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"__name__":"wait_bucket","le":"1"},"value":[1700000000,"2"]},
+				{"metric":{"__name__":"wait_bucket","le":"+Inf"},"value":[1700000000,"3"]},
+				{"metric":{"__name__":"wait_sum"},"value":[1700000000,"1.5"]},
+				{"metric":{"__name__":"wait_count"},"value":[1700000000,"3"]}]}}`)
+		case r.URL.Path == "/api/v1/query_range":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"__name__":"wait_sum"},"values":[[1700000000,"1"],[1700000015,"1.5"]]}]}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"unknown"}`)
+		}
+	}))
+	defer server.Close()
+
+	p, err := NewPrometheus(server.URL, []string{"wait", "sum(up)"}, config.ApplicationConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrapes, err := p.Backfill(time.Minute, 15*time.Second)
+	if err != nil || len(scrapes) != 2 || !scrapes[0].Time.Before(scrapes[1].Time) {
+		t.Fatalf("expected two scrapes in time order, got %d %v", len(scrapes), err)
+	}
+	data, err := p.Scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait := findMetric(data, "wait")
+	if wait == nil || wait.Type != "histogram" || wait.Values[0].Count != "3" || wait.Values[0].PreviousValue != "1.5" {
+		t.Errorf("expected the folded histogram after the backfill, got %+v", wait)
+	}
+	if query := findMetric(data, "query_2"); query == nil || query.Description != "sum(up)" {
+		t.Errorf("expected the result without a name to be named after its query, got %+v", query)
+	}
+	// wait, wait_bucket, wait_sum and wait_count once
+	if n := metadataRequests.Load(); n != 4 {
+		t.Errorf("expected the metadata of every family once, got %d requests", n)
+	}
+}
+
+func TestPrometheusWithoutMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/metadata" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"wait_sum"},"value":[1700000000,"1.5"]},
+			{"metric":{"__name__":"wait_count"},"value":[1700000000,"3"]}]}}`)
+	}))
+	defer server.Close()
+
+	p, err := NewPrometheus(server.URL, []string{"wait"}, config.ApplicationConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := []error{}
+	p.SetErrorHandler(func(err error) { errs = append(errs, err) })
+	data, err := p.Scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Metrics) != 2 || len(errs) != 1 {
+		t.Errorf("expected the series as families and the error reported, got %d metrics and %v", len(data.Metrics), errs)
+	}
+	if _, err := p.Scrape(); err != nil || len(errs) != 1 {
+		t.Errorf("expected the metadata not to be requested again right away, got %v %v", err, errs)
+	}
+}
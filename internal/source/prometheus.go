@@ -0,0 +1,365 @@
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	maxBackfillSteps = 600              // scrapes a backfill can have at most, the size of the history in memory
+	metadataRefresh  = 10 * time.Minute // the metadata of a family is fetched again after this
+)
+
+// namespace/service:port of a Prometheus service, queried through the apiserver proxy
+var serviceRegex = regexp.MustCompile(`^([a-z0-9-]+)/([a-z0-9-]+):([a-z0-9-]+)$`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Create a source for a server, which is a configured target, an url or a service like monitoring/prometheus:9090.
+// Without queries the configured metrics are queried. The rest config is only loaded for a service.
+func NewPrometheus(server string, queries []string, appConfig config.ApplicationConfig, restConfig func() *rest.Config) (*Prometheus, error) {
+	p := &Prometheus{
+		queries:         queries,
+		metadata:        make(map[string]prometheusMetadata),
+		metadataFetched: make(map[string]time.Time),
+		onError:         func(error) {},
+		evictStaleAfter: appConfig.Settings.EvictStaleAfter,
+	}
+	if len(p.queries) == 0 {
+		p.queries = []string{metricsQuery(appConfig.AllMetrics())}
+	}
+
+	target, configured := appConfig.Target(server)
+	if !configured {
+		target = config.Target{URL: server}
+	}
+	if match := serviceRegex.FindStringSubmatch(server); match != nil && !configured {
+		cluster := restConfig()
+		client, err := rest.HTTPClientFor(cluster)
+		if err != nil {
+			return nil, err
+		}
+		service := discovery.Target{Kind: "service", Namespace: match[1], Name: match[2], Port: match[3]}
+		p.url = strings.TrimSuffix(cluster.Host, "/") + service.URLPath()
+		p.client = client
+		p.authorize = func(*http.Request) error { return nil }
+	} else {
+		h, err := NewHTTP(target, appConfig)
+		if err != nil {
+			return nil, err
+		}
+		p.url = strings.TrimSuffix(h.target.URL, "/")
+		p.client = h.client
+		p.authorize = h.authorize
+	}
+
+	return p, nil
+}
+
+var _ Reporter = (*Prometheus)(nil)
+
+// Pass problems which don't stop the queries to the handler, like metadata which can't be fetched
+func (p *Prometheus) SetErrorHandler(handler func(error)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.onError = handler
+}
+
+// Query for the families of the metrics with the series of histograms and summaries
+func metricsQuery(metrics []string) string {
+	names := make([]string, len(metrics))
+	for i, m := range metrics {
+		names[i] = regexp.QuoteMeta(m)
+	}
+	return fmt.Sprintf(`{__name__=~"(%s)(_bucket|_sum|_count)?"}`, strings.Join(names, "|"))
+}
+
+// Evaluate the queries now
+func (p *Prometheus) Scrape() (realtimedata.RealTimeData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	samples := []prometheusSample{}
+	for i, query := range p.queries {
+		form := url.Values{"query": {query}, "time": {formatTime(now)}}
+		var result prometheusResult
+		if err := p.call("/api/v1/query", form, &result); err != nil {
+			return realtimedata.RealTimeData{}, fmt.Errorf("query %q: %v", query, err)
+		}
+		series, err := result.series()
+		if err != nil {
+			return realtimedata.RealTimeData{}, fmt.Errorf("query %q: %v", query, err)
+		}
+		for _, s := range series {
+			samples = append(samples, prometheusSample{query: i, labels: s.Metric, value: s.Value.Value})
+		}
+	}
+	p.updateMetadata(now, samples)
+	if err := p.parse(now, samples); err != nil {
+		return realtimedata.RealTimeData{}, err
+	}
+	return p.data.Snapshot(), nil
+}
+
+func (p *Prometheus) Backfill(duration, step time.Duration) ([]realtimedata.RealTimeData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	step = max(step, duration/maxBackfillSteps)
+	end := time.Now()
+	start := end.Add(-duration)
+	steps := make(map[float64][]prometheusSample)
+	for i, query := range p.queries {
+		form := url.Values{"query": {query}, "start": {formatTime(start)}, "end": {formatTime(end)}, "step": {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)}}
+		var result prometheusResult
+		if err := p.call("/api/v1/query_range", form, &result); err != nil {
+			return nil, fmt.Errorf("query %q: %v", query, err)
+		}
+		series, err := result.series()
+		if err != nil {
+			return nil, fmt.Errorf("query %q: %v", query, err)
+		}
+		for _, s := range series {
+			for _, point := range s.Values {
+				steps[point.Time] = append(steps[point.Time], prometheusSample{query: i, labels: s.Metric, value: point.Value})
+			}
+		}
+	}
+
+	times := make([]float64, 0, len(steps))
+	for t, samples := range steps {
+		times = append(times, t)
+		p.updateMetadata(end, samples)
+	}
+	sort.Float64s(times)
+	scrapes := make([]realtimedata.RealTimeData, 0, len(times))
+	for _, t := range times {
+		if err := p.parse(time.UnixMilli(int64(t*1000)), steps[t]); err != nil {
+			return nil, err
+		}
+		scrapes = append(scrapes, p.data.Snapshot())
+	}
+	return scrapes, nil
+}
+
+// Parse the samples of an evaluation as the next scrape
+func (p *Prometheus) parse(evaluation time.Time, samples []prometheusSample) error {
+	p.data.NextGeneration()
+	p.data.Time = evaluation
+	if err := p.data.Parse(bytes.NewReader(p.page(samples)), nil); err != nil {
+		return err
+	}
+	p.data.EvictStale(p.evictStaleAfter)
+	return nil
+}
+
+// Samples in the text format, grouped by family with the metadata first.
+// Results without a name, like aggregations, are named after their query.
+func (p *Prometheus) page(samples []prometheusSample) []byte {
+	families := []string{}
+	lines := make(map[string][]string)
+	help := make(map[string]string)
+	for _, s := range samples {
+		name, ok := s.labels["__name__"]
+		family := p.family(name)
+		if !ok {
+			name = fmt.Sprintf("query_%d", s.query+1)
+			family = name
+			help[family] = p.queries[s.query]
+		}
+		if _, ok := lines[family]; !ok {
+			families = append(families, family)
+		}
+		lines[family] = append(lines[family], name+formatLabels(s.labels)+" "+s.value)
+	}
+
+	var page bytes.Buffer
+	for _, family := range families {
+		metadata, ok := p.metadata[family]
+		if ok {
+			help[family] = metadata.Help
+		}
+		if help[family] != "" {
+			fmt.Fprintf(&page, "# HELP %s %s\n", family, strings.ReplaceAll(help[family], "\n", " "))
+		}
+		if ok && metadata.Type != "" {
+			fmt.Fprintf(&page, "# TYPE %s %s\n", family, metadata.Type)
+		}
+		for _, line := range lines[family] {
+			page.WriteString(line + "\n")
+		}
+	}
+	return page.Bytes()
+}
+
+// Family of a series name, the _bucket, _sum and _count series belong to a histogram or summary
+func (p *Prometheus) family(name string) string {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		if m := p.metadata[base]; m.Type == "histogram" || (m.Type == "summary" && suffix != "_bucket") {
+			return base
+		}
+	}
+	return name
+}
+
+// Labels sorted by name without __name__, like {a="1",b="2"}
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		if name != "__name__" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(labels[name]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Fetch the metadata of the families of the samples which haven't been fetched for metadataRefresh,
+// the name of a series and the name without _bucket, _sum or _count can be the family
+func (p *Prometheus) updateMetadata(now time.Time, samples []prometheusSample) {
+	failed := []string{}
+	var lastErr error
+	for _, s := range samples {
+		name, ok := s.labels["__name__"]
+		if !ok {
+			continue
+		}
+		candidates := []string{name}
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base, ok := strings.CutSuffix(name, suffix); ok {
+				candidates = append(candidates, base)
+			}
+		}
+		for _, family := range candidates {
+			if fetched, ok := p.metadataFetched[family]; ok && now.Sub(fetched) < metadataRefresh {
+				continue
+			}
+			p.metadataFetched[family] = now // also after an error, so it is tried again after metadataRefresh
+			if err := p.fetchMetadata(family); err != nil {
+				failed = append(failed, family)
+				lastErr = err
+			}
+		}
+	}
+	if lastErr != nil {
+		logrus.Debugf("Unable to get the metadata of %s from %s: %v", strings.Join(failed, ", "), p, lastErr)
+		p.onError(fmt.Errorf("no metadata for %d metrics, histograms and summaries are shown as separate series: %v", len(failed), lastErr))
+	}
+}
+
+func (p *Prometheus) fetchMetadata(family string) error {
+	metadata := make(map[string][]prometheusMetadata)
+	if err := p.call("/api/v1/metadata?"+url.Values{"metric": {family}}.Encode(), nil, &metadata); err != nil {
+		return err
+	}
+	if m := metadata[family]; len(m) > 0 {
+		p.metadata[family] = m[0]
+	} else {
+		delete(p.metadata, family)
+	}
+	return nil
+}
+
+// Call an endpoint of the API, a form is posted, and decode the data of the response
+func (p *Prometheus) call(path string, form url.Values, data interface{}) error {
+	method, body := http.MethodGet, io.Reader(nil)
+	if form != nil {
+		method, body = http.MethodPost, strings.NewReader(form.Encode())
+	}
+	request, err := http.NewRequest(method, p.url+path, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if err := p.authorize(request); err != nil {
+		return err
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var apiResponse prometheusResponse
+	if err := json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
+		return fmt.Errorf("http error %s", response.Status)
+	}
+	if apiResponse.Status != "success" {
+		return fmt.Errorf("%s: %s", apiResponse.ErrorType, apiResponse.Error)
+	}
+	return json.Unmarshal(apiResponse.Data, data)
+}
+
+// Series of a vector or matrix, a scalar is a series without labels
+func (r prometheusResult) series() ([]prometheusSeries, error) {
+	switch r.ResultType {
+	case "vector", "matrix":
+		series := []prometheusSeries{}
+		return series, json.Unmarshal(r.Result, &series)
+	case "scalar":
+		var point prometheusPoint
+		if err := json.Unmarshal(r.Result, &point); err != nil {
+			return nil, err
+		}
+		return []prometheusSeries{{Value: point, Values: []prometheusPoint{point}}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported result type %q", r.ResultType)
+	}
+}
+
+func (p *prometheusPoint) UnmarshalJSON(b []byte) error {
+	var point []interface{}
+	if err := json.Unmarshal(b, &point); err != nil {
+		return err
+	}
+	if len(point) != 2 {
+		return fmt.Errorf("invalid sample %s", b)
+	}
+	t, ok := point[0].(float64)
+	value, ok2 := point[1].(string)
+	if !ok || !ok2 {
+		return fmt.Errorf("invalid sample %s", b)
+	}
+	p.Time, p.Value = t, value
+	return nil
+}
+
+func (p *Prometheus) SetConfig(config config.ApplicationConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.evictStaleAfter = config.Settings.EvictStaleAfter
+}
+
+func (p *Prometheus) String() string {
+	return "prometheus " + p.url
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64)
+}
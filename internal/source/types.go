@@ -0,0 +1,139 @@
+package source
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"k8s.io/client-go/rest"
+)
+
+// Yields the metrics to view, like the apiserver scraper or a file
+type Source interface {
+	// Data of the next scrape, a snapshot which the caller owns
+	Scrape() (realtimedata.RealTimeData, error)
+	// Shown in the UI
+	String() string
+}
+
+// Source which selects its metrics or evicts series with the config
+type Configurable interface {
+	SetConfig(config config.ApplicationConfig)
+}
+
+// Source in a Kubernetes cluster, which enables the APF page and the target picker
+type Kubernetes interface {
+	RestConfig() *rest.Config
+	Target() discovery.Target
+	SetTarget(target discovery.Target)
+}
+
+// Source which can fill the history with the past, like a Prometheus server
+type Backfiller interface {
+	// Scrapes of the last duration at least step apart, oldest first
+	Backfill(duration, step time.Duration) ([]realtimedata.RealTimeData, error)
+}
+
+// Source with problems which don't stop the scrapes, like missing metadata of a Prometheus server
+type Reporter interface {
+	SetErrorHandler(handler func(error))
+}
+
+// Metrics in the Prometheus text format on disk. A file is read again on every scrape,
+// the dumps of a directory are replayed one per scrape in the order of their names.
+type File struct {
+	mutex           sync.Mutex
+	path            string
+	files           []string // dumps of a directory, nil for a file
+	next            int      // next dump to replay
+	data            realtimedata.RealTimeData
+	evictStaleAfter int
+}
+
+// Prometheus endpoint scraped over plain HTTP(S), without Kubernetes
+type HTTP struct {
+	mutex           sync.Mutex
+	target          config.Target // with the credentials of the url moved to the fields
+	configured      config.Target // as in the config, to see if a reload changed it
+	client          *http.Client
+	data            realtimedata.RealTimeData
+	evictStaleAfter int
+}
+
+// Prometheus compatible server queried with PromQL over its HTTP API.
+// The results are written in the text format and parsed, so histograms and summaries are folded like scrapes.
+type Prometheus struct {
+	mutex           sync.Mutex
+	url             string // of the server, without /api/v1
+	client          *http.Client
+	authorize       func(request *http.Request) error
+	queries         []string
+	metadata        map[string]prometheusMetadata // by family
+	metadataFetched map[string]time.Time          // name -> time of the last metadata request
+	onError         func(error)
+	data            realtimedata.RealTimeData
+	evictStaleAfter int
+}
+
+type prometheusMetadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+}
+
+// Response of the query, query_range and metadata endpoints
+type prometheusResponse struct {
+	Status    string          `json:"status"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type prometheusResult struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// Series of a vector or matrix result
+type prometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  prometheusPoint   `json:"value"`  // vector
+	Values []prometheusPoint `json:"values"` // matrix
+}
+
+// [ <unix time>, "<value>" ]
+type prometheusPoint struct {
+	Time  float64
+	Value string
+}
+
+// Sample of a query result to write in the text format
+type prometheusSample struct {
+	query  int // index of the query, names the results without __name__
+	labels map[string]string
+	value  string
+}
+
+// Generated metrics of an apiserver with load waves, flow schemas which come and go and restarts which
+// reset the counters, to try the viewer without a cluster
+type Demo struct {
+	mutex           sync.Mutex
+	random          *rand.Rand
+	scrape          int
+	counters        map[string]float64   // by series, cleared by a restart
+	histograms      map[string][]float64 // cumulative bucket counts by series
+	sums            map[string]float64   // of the histograms and summaries
+	data            realtimedata.RealTimeData
+	evictStaleAfter int
+}
+
+// Priority level of the demo with its flow schemas
+type demoLevel struct {
+	name    string
+	seats   float64
+	schemas []string
+}
@@ -0,0 +1,172 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/apf"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+var (
+	apfLevelHeaders  = []string{"Priority level", "Type", "Shares", "Lendable", "Borrowing", "Nominal", "Lower", "Upper", "Current", "Executing", "Seats", "In queue", "Rejected/s", "Wait p50", "Wait p90", "Wait p99", "Queuing"}
+	apfSchemaHeaders = []string{"Precedence", "Flow schema", "Priority level", "Distinguisher", "Rules"}
+)
+
+// Set the function which fetches the APF configuration from the cluster
+func (ui *UI) SetAPFSource(source func() (apf.Configuration, error)) {
+	ui.apfSource = source
+}
+
+func newAPFView(ui *UI) *tview.Flex {
+	ui.apfLevels = tview.NewTable().SetFixed(1, 1).SetSelectable(true, false)
+	ui.apfLevels.SetBorder(true).SetTitle(" Priority levels ")
+	ui.apfSchemas = tview.NewTable().SetFixed(1, 0).SetSelectable(true, false)
+	ui.apfSchemas.SetBorder(true).SetTitle(" Flow schemas ")
+	return tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(ui.apfLevels, 0, 1, true).
+		AddItem(ui.apfSchemas, 0, 1, false)
+}
+
+func (ui *UI) toggleAPF() {
+	ui.apfMode = !ui.apfMode
+	switch {
+	case ui.apfMode:
+		ui.body.SwitchToPage("apf")
+		if ui.apfConfig == nil {
+			ui.refreshAPFConfig()
+		}
+		ui.renderAPF()
+	case ui.treeMode:
+		ui.body.SwitchToPage("tree")
+	default:
+		ui.body.SwitchToPage("table")
+	}
+	ui.app.SetFocus(ui.bodyPrimitive())
+}
+
+// Fetch the priority level configurations and flow schemas in the background
+func (ui *UI) refreshAPFConfig() {
+	if ui.apfSource == nil {
+		return
+	}
+	source := ui.apfSource
+	go func() {
+		configuration, err := source()
+		if err != nil {
+			ui.ShowError(err)
+			return
+		}
+		ui.app.QueueUpdateDraw(func() {
+			ui.apfConfig = &configuration
+			ui.renderAPF()
+		})
+		ui.ShowMessage(fmt.Sprintf("fetched %d priority levels and %d flow schemas", len(configuration.PriorityLevels), len(configuration.FlowSchemas)))
+	}()
+}
+
+func (ui *UI) renderAPF() {
+	if !ui.apfMode {
+		return
+	}
+	ui.renderAPFLevels(apf.Summarize(ui.data, ui.apfConfig))
+	ui.renderAPFSchemas()
+}
+
+func (ui *UI) renderAPFLevels(levels []apf.PriorityLevel) {
+	ui.apfLevels.Clear()
+	setHeaderCells(ui.apfLevels, apfLevelHeaders)
+	for i, l := range levels {
+		cells := []string{l.Name, "", "", "", "",
+			formatFloat(l.NominalSeats), formatFloat(l.LowerSeats), formatFloat(l.UpperSeats), formatFloat(l.CurrentSeats),
+			formatFloat(l.Executing), formatFloat(l.ExecutingSeats), formatFloat(l.InQueue), formatFloat(l.RejectedRate),
+			formatDuration(l.WaitP50), formatDuration(l.WaitP90), formatDuration(l.WaitP99), ""}
+		if c := l.Config; c != nil {
+			cells[1] = c.Type
+			cells[2] = strconv.Itoa(int(c.NominalConcurrencyShares))
+			cells[3] = fmt.Sprintf("%d%%", c.LendablePercent)
+			cells[4] = "unlimited"
+			if c.BorrowingLimitPercent != nil {
+				cells[4] = fmt.Sprintf("%d%%", *c.BorrowingLimitPercent)
+			}
+			cells[16] = c.Queuing
+		}
+		for column, text := range cells {
+			cell := tview.NewTableCell(tview.Escape(text))
+			if column > 0 {
+				cell.SetAlign(tview.AlignRight)
+			}
+			if column == 12 && l.RejectedRate > 0 {
+				cell.SetTextColor(tcell.ColorRed)
+			}
+			if column == 11 && l.InQueue > 0 {
+				cell.SetTextColor(tcell.ColorYellow)
+			}
+			ui.apfLevels.SetCell(i+1, column, cell)
+		}
+	}
+}
+
+func (ui *UI) renderAPFSchemas() {
+	ui.apfSchemas.Clear()
+	setHeaderCells(ui.apfSchemas, apfSchemaHeaders)
+	if ui.apfConfig == nil {
+		ui.apfSchemas.SetCell(1, 1, tview.NewTableCell("[gray]not fetched, press r to retry"))
+		return
+	}
+	for i, fs := range ui.apfConfig.FlowSchemas {
+		cells := []string{strconv.Itoa(int(fs.MatchingPrecedence)), fs.Name, fs.PriorityLevel, fs.Distinguisher, strings.Join(fs.Rules, " | ")}
+		for column, text := range cells {
+			ui.apfSchemas.SetCell(i+1, column, tview.NewTableCell(tview.Escape(text)))
+		}
+	}
+}
+
+func setHeaderCells(table *tview.Table, headers []string) {
+	for column, header := range headers {
+		table.SetCell(0, column, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorWhite).
+			SetBackgroundColor(tcell.ColorDarkBlue))
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsNaN(f) {
+		return "-"
+	}
+	return formatValue(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func formatDuration(seconds float64) string {
+	switch {
+	case math.IsNaN(seconds):
+		return "-"
+	case seconds < 1:
+		return fmt.Sprintf("%.1fms", seconds*1000)
+	default:
+		return fmt.Sprintf("%.2fs", seconds)
+	}
+}
+
+// Handle the keys of the APF page, returns true if the key was used
+func (ui *UI) handleAPFKeyEvents(event *tcell.EventKey) bool {
+	switch {
+	case event.Key() == tcell.KeyTab:
+		if ui.app.GetFocus() == ui.apfLevels {
+			ui.app.SetFocus(ui.apfSchemas)
+		} else {
+			ui.app.SetFocus(ui.apfLevels)
+		}
+	case event.Key() == tcell.KeyEscape || event.Rune() == 'a':
+		ui.toggleAPF()
+	case event.Rune() == 'r':
+		ui.refreshAPFConfig()
+	default:
+		return false
+	}
+	return true
+}
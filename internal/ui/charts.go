@@ -0,0 +1,184 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/filter"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	chartsPaneHeight = 10
+	maxChartPoints   = 600 // scrapes kept per chart
+)
+
+var chartBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// Scrapes of a chart, the charts of all views are kept so switching views doesn't lose them
+type chartSeries struct {
+	points  []chartPoint
+	counter bool // charted as a rate
+}
+
+type chartPoint struct {
+	Time  time.Time
+	Value float64 // sum of the matching series
+}
+
+func chartKey(chart config.Chart) string {
+	return chart.Metric + "{" + chart.Filter + "}"
+}
+
+// Add the last scrape to the charts of all views, once per scrape
+func (ui *UI) recordCharts() {
+	if ui.data.Generation == ui.chartsScrape {
+		return
+	}
+	ui.chartsScrape = ui.data.Generation
+	now := time.Now()
+	for _, view := range ui.views {
+		for _, chart := range view.Charts {
+			key := chartKey(chart)
+			series, ok := ui.chartSeries[key]
+			if !ok {
+				series = &chartSeries{}
+				ui.chartSeries[key] = series
+			}
+			if n := len(series.points); n > 0 && series.points[n-1].Time.Equal(now) {
+				continue // the same chart in another view
+			}
+			var expression filter.Expression
+			if chart.Filter != "" {
+				var err error
+				if expression, err = filter.Parse(chart.Filter); err != nil {
+					continue // rejected by the config validation
+				}
+			}
+			sum := 0.0
+			for i := range ui.data.Metrics {
+				metric := &ui.data.Metrics[i]
+				if metric.Name != chart.Metric {
+					continue
+				}
+				series.counter = metric.Type == "counter"
+				for j := range metric.Values {
+					value := &metric.Values[j]
+					if value.LastSeen != ui.data.Generation || !filter.Match(expression, metric, value) {
+						continue
+					}
+					if f, err := strconv.ParseFloat(value.Value, 64); err == nil {
+						sum += f
+					}
+				}
+			}
+			series.points = append(series.points, chartPoint{Time: now, Value: sum})
+			if len(series.points) > maxChartPoints {
+				series.points = series.points[len(series.points)-maxChartPoints:]
+			}
+		}
+	}
+}
+
+// Show the charts of the current view under the table, the pane is hidden if the view has none
+func (ui *UI) renderCharts() {
+	ui.chartsFlex.Clear()
+	charts := ui.views[ui.currentView].Charts
+	for _, chart := range charts {
+		chart := chart
+		box := tview.NewBox().SetBorder(true)
+		box.SetDrawFunc(func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
+			ui.drawChart(screen, chart, x+1, y+1, width-2, height-2)
+			return x + 1, y + 1, width - 2, height - 2
+		})
+		ui.chartsFlex.AddItem(box, 0, 1, false)
+	}
+	height := 0
+	if len(charts) > 0 {
+		height = chartsPaneHeight
+	}
+	ui.appFlex.ResizeItem(ui.chartsFlex, height, 0)
+}
+
+// Values of a chart, the per second change for counters with NaN for a reset
+func (series *chartSeries) values() ([]chartPoint, string) {
+	if !series.counter {
+		return series.points, ""
+	}
+	rates := []chartPoint{}
+	for i := 1; i < len(series.points); i++ {
+		previous, point := series.points[i-1], series.points[i]
+		rate := math.NaN()
+		if seconds := point.Time.Sub(previous.Time).Seconds(); seconds > 0 && point.Value >= previous.Value {
+			rate = (point.Value - previous.Value) / seconds
+		}
+		rates = append(rates, chartPoint{Time: point.Time, Value: rate})
+	}
+	return rates, "/s"
+}
+
+// Bars of the last values with the range on the left, the time axis with a ! for the events between two scrapes at the bottom,
+// the title with the last value is drawn on the border above
+func (ui *UI) drawChart(screen tcell.Screen, chart config.Chart, x, y, width, height int) {
+	title := tview.Escape(chart.Metric)
+	if chart.Filter != "" {
+		title += " " + tview.Escape(chart.Filter)
+	}
+	series, ok := ui.chartSeries[chartKey(chart)]
+	if !ok {
+		tview.Print(screen, fmt.Sprintf(" %s [gray](waiting) ", title), x, y-1, width, tview.AlignCenter, tcell.ColorWhite)
+		return
+	}
+	points, unit := series.values()
+	if len(points) > 0 {
+		title += fmt.Sprintf(" [gray]%s%s", formatFloat(points[len(points)-1].Value), unit)
+	}
+	tview.Print(screen, " "+title+" ", x, y-1, width, tview.AlignCenter, tcell.ColorWhite)
+
+	low, high := 0.0, 0.0
+	for _, point := range points {
+		if !math.IsNaN(point.Value) {
+			low, high = math.Min(low, point.Value), math.Max(high, point.Value)
+		}
+	}
+	if high == low {
+		high = low + 1
+	}
+	highLabel, lowLabel := formatFloat(high), formatFloat(low)
+	labelWidth := max(len(highLabel), len(lowLabel)) + 1
+	rows, columns := height-1, width-labelWidth
+	if rows < 1 || columns < 1 {
+		return
+	}
+	tview.Print(screen, highLabel, x, y, labelWidth-1, tview.AlignRight, tcell.ColorGray)
+	tview.Print(screen, lowLabel, x, y+rows-1, labelWidth-1, tview.AlignRight, tcell.ColorGray)
+
+	plotX, axisY := x+labelWidth, y+rows
+	points = points[max(len(points)-columns, 0):]
+	for i, point := range points {
+		if math.IsNaN(point.Value) {
+			continue
+		}
+		eighths := int(math.Round((point.Value - low) / (high - low) * float64(rows*8)))
+		for row := 0; row < rows && eighths > row*8; row++ {
+			screen.SetContent(plotX+i, axisY-1-row, chartBlocks[min(eighths-row*8, 8)], nil, tcell.StyleDefault.Foreground(tcell.ColorLightBlue))
+		}
+	}
+
+	for i := 0; i < columns; i++ {
+		screen.SetContent(plotX+i, axisY, '─', nil, tcell.StyleDefault.Foreground(tcell.ColorGray))
+	}
+	if len(points) > 0 {
+		tview.Print(screen, points[0].Time.Local().Format("15:04:05"), plotX, axisY, columns, tview.AlignLeft, tcell.ColorGray)
+		tview.Print(screen, points[len(points)-1].Time.Local().Format("15:04:05"), plotX, axisY, columns, tview.AlignRight, tcell.ColorGray)
+	}
+	for i := 1; i < len(points); i++ {
+		if marker, color := ui.eventMarker(points[i-1].Time.UnixMilli(), points[i].Time.UnixMilli()); marker != "" {
+			screen.SetContent(plotX+i, axisY, '!', nil, tcell.StyleDefault.Foreground(color))
+		}
+	}
+}
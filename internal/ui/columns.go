@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const minColumnWidth = 3
+
+// Add label keys not seen before as new columns, keeping the current order
+func (ui *UI) syncColumns() {
+	known := make(map[string]struct{}, len(ui.columns))
+	for _, c := range ui.columns {
+		known[c.Key] = struct{}{}
+	}
+	newKeys := []string{}
+	for _, row := range ui.rows {
+		for key := range row.Labels {
+			if _, ok := known[key]; !ok {
+				known[key] = struct{}{}
+				newKeys = append(newKeys, key)
+			}
+		}
+	}
+	sort.Strings(newKeys)
+	for _, key := range newKeys {
+		ui.columns = append(ui.columns, &tableColumn{Key: key, Hidden: ui.hideNewColumns})
+	}
+}
+
+func (ui *UI) visibleColumns() []*tableColumn {
+	visible := []*tableColumn{}
+	for _, c := range ui.columns {
+		if !c.Hidden {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+func (ui *UI) renderColumnarTable(rows []TableRow) {
+	ui.syncColumns()
+	visible := ui.visibleColumns()
+	if ui.columnCursor >= len(visible) {
+		ui.columnCursor = len(visible) - 1
+	}
+	if ui.columnCursor < 0 {
+		ui.columnCursor = 0
+	}
+
+	ui.table.Clear()
+	ui.table.SetFixed(1, 0)
+
+	headerStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDarkBlue)
+	columnHeaderStyle := tcell.StyleDefault.Foreground(tcell.ColorYellow).Background(tcell.ColorDarkCyan)
+	cursorStyle := tcell.StyleDefault.Foreground(tcell.ColorDarkCyan).Background(tcell.ColorYellow)
+
+	for i, c := range visible {
+		style := columnHeaderStyle
+		if i == ui.columnCursor {
+			style = cursorStyle
+		}
+		ui.table.SetCell(0, i, withWidth(tview.NewTableCell(c.Key).
+			SetStyle(style).
+			SetSelectable(false), c.Width))
+	}
+	ui.table.SetCell(0, len(visible), tview.NewTableCell("value").
+		SetStyle(columnHeaderStyle).
+		SetSelectable(false).
+		SetExpansion(1))
+
+	rowIndex := 1
+	var currentMetric string
+	for _, row := range rows {
+		if row.MetricName != currentMetric {
+			ui.table.SetCell(rowIndex, 0, tview.NewTableCell(fmt.Sprintf("%s [gray](%s)", row.MetricName, row.Type)).
+				SetStyle(headerStyle).
+				SetSelectable(false))
+			for i := 1; i <= len(visible); i++ {
+				ui.table.SetCell(rowIndex, i, tview.NewTableCell("").
+					SetStyle(headerStyle).
+					SetSelectable(false))
+			}
+			rowIndex++
+			currentMetric = row.MetricName
+		}
+		for i, c := range visible {
+			ui.table.SetCell(rowIndex, i, withWidth(tview.NewTableCell(row.Labels[c.Key]), c.Width))
+		}
+		ui.table.SetCell(rowIndex, len(visible), tview.NewTableCell(formatRowValue(row)).
+			SetExpansion(1))
+		ui.table.GetCell(rowIndex, 0).SetReference(row.ID)
+		rowIndex++
+	}
+}
+
+func withWidth(cell *tview.TableCell, width int) *tview.TableCell {
+	if width > 0 {
+		cell.SetMaxWidth(width)
+	}
+	return cell
+}
+
+// Handle the spreadsheet keys of the columnar mode, returns true if the key was used
+func (ui *UI) handleColumnKeyEvents(event *tcell.EventKey) bool {
+	visible := ui.visibleColumns()
+	switch event.Rune() {
+	case '[':
+		if ui.columnCursor > 0 {
+			ui.columnCursor--
+		}
+	case ']':
+		if ui.columnCursor < len(visible)-1 {
+			ui.columnCursor++
+		}
+	case '{':
+		ui.moveColumn(visible, -1)
+	case '}':
+		ui.moveColumn(visible, 1)
+	case '-':
+		ui.resizeColumn(visible, -2)
+	case '+':
+		ui.resizeColumn(visible, 2)
+	case 'h':
+		if len(visible) > 0 {
+			visible[ui.columnCursor].Hidden = true
+		}
+	case 'H':
+		for _, c := range ui.columns {
+			c.Hidden = false
+		}
+	default:
+		return false
+	}
+	ui.renderTable()
+	return true
+}
+
+// Swap the column under the cursor with its visible neighbour
+func (ui *UI) moveColumn(visible []*tableColumn, direction int) {
+	target := ui.columnCursor + direction
+	if len(visible) == 0 || target < 0 || target >= len(visible) {
+		return
+	}
+	a, b := indexOfColumn(ui.columns, visible[ui.columnCursor]), indexOfColumn(ui.columns, visible[target])
+	ui.columns[a], ui.columns[b] = ui.columns[b], ui.columns[a]
+	ui.columnCursor = target
+}
+
+func (ui *UI) resizeColumn(visible []*tableColumn, delta int) {
+	if len(visible) == 0 {
+		return
+	}
+	c := visible[ui.columnCursor]
+	if c.Width == 0 { // start from the current content width
+		c.Width = len(c.Key)
+		for _, row := range ui.rows {
+			if len(row.Labels[c.Key]) > c.Width {
+				c.Width = len(row.Labels[c.Key])
+			}
+		}
+	}
+	c.Width += delta
+	if c.Width < minColumnWidth {
+		c.Width = minColumnWidth
+	}
+}
+
+func indexOfColumn(columns []*tableColumn, column *tableColumn) int {
+	for i, c := range columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
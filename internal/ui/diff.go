@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bvankampen/metrics-viewer/internal/diff"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+var diffHeaders = []string{"Kind", "Metric", "Type", "Labels", "Measure", "Before", "After", "Delta"}
+
+// Show the result of a diff in its own application until q or Esc is pressed
+func RunDiff(result diff.Result) error {
+	app := tview.NewApplication()
+
+	header := tview.NewTextView().SetDynamicColors(true)
+	header.SetBackgroundColor(tcell.ColorDarkCyan)
+	header.SetText(fmt.Sprintf("[yellow]%s[white] -> [yellow]%s[white]  families [green]+%d[white] [red]-%d[white]  series [green]+%d[white] [red]-%d",
+		tview.Escape(result.Before), tview.Escape(result.After),
+		len(result.AddedFamilies), len(result.RemovedFamilies), result.AddedSeries, result.RemovedSeries))
+
+	table := tview.NewTable().SetFixed(1, 0).SetSelectable(true, false)
+	footer := tview.NewFlex()
+	footer.SetBackgroundColor(tcell.ColorDarkCyan)
+	keys := tview.NewTextView().SetDynamicColors(true).SetText("[yellow]q:[white] Quit [yellow]/:[white] Filter")
+	keys.SetBackgroundColor(tcell.ColorDarkCyan)
+	footer.AddItem(keys, 0, 1, false)
+
+	renderDiffTable(table, result.Changes, nil)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(header, 1, 1, false).
+		AddItem(table, 0, 1, true).
+		AddItem(footer, 1, 1, false)
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if _, ok := app.GetFocus().(*tview.InputField); ok {
+			return event
+		}
+		switch {
+		case event.Rune() == 'q' || event.Key() == tcell.KeyEscape:
+			app.Stop()
+			return nil
+		case event.Rune() == '/':
+			input := tview.NewInputField().SetLabel("Filter (regex): ")
+			input.SetFieldBackgroundColor(tcell.ColorDarkBlue)
+			input.SetBackgroundColor(tcell.ColorDarkCyan)
+			input.SetDoneFunc(func(key tcell.Key) {
+				if key == tcell.KeyEnter {
+					expression, err := regexp.Compile(input.GetText())
+					if err != nil {
+						input.SetLabel("[red]Invalid regex, filter (regex): ")
+						return
+					}
+					renderDiffTable(table, result.Changes, expression)
+				}
+				footer.RemoveItem(input)
+				footer.AddItem(keys, 0, 1, false)
+				app.SetFocus(table)
+			})
+			footer.RemoveItem(keys)
+			footer.AddItem(input, 0, 1, true)
+			app.SetFocus(input)
+			return nil
+		}
+		return event
+	})
+	return app.SetRoot(layout, true).Run()
+}
+
+func renderDiffTable(table *tview.Table, changes []diff.Change, expression *regexp.Regexp) {
+	table.Clear()
+	setHeaderCells(table, diffHeaders)
+	row := 1
+	for _, change := range changes {
+		if expression != nil && !expression.MatchString(change.Metric) && !expression.MatchString(change.Labels) {
+			continue
+		}
+		color := tcell.ColorWhite
+		switch change.Kind {
+		case "added":
+			color = tcell.ColorGreen
+		case "removed":
+			color = tcell.ColorRed
+		}
+		cells := []string{change.Kind, change.Metric, change.Type, change.Labels, change.Measure, "", "", ""}
+		if change.Kind == "changed" {
+			cells[5] = diff.FormatNumber(change.Before)
+			cells[6] = diff.FormatNumber(change.After)
+			cells[7] = diff.FormatNumber(change.Delta)
+			if change.Delta > 0 {
+				cells[7] = "+" + cells[7]
+			}
+		}
+		for column, text := range cells {
+			cell := tview.NewTableCell(tview.Escape(text)).SetTextColor(color)
+			if column >= 5 {
+				cell.SetAlign(tview.AlignRight)
+			}
+			if column == 7 && change.Delta > 0 {
+				cell.SetTextColor(tcell.ColorGreen)
+			}
+			if column == 7 && change.Delta < 0 {
+				cell.SetTextColor(tcell.ColorRed)
+			}
+			table.SetCell(row, column, cell)
+		}
+		row++
+	}
+}
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/events"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	maxEvents         = 500 // newest events kept for the timeline
+	eventsPaneHeight  = 10
+	maxHistoryReasons = 3 // reasons shown per sample of a history
+)
+
+var eventsHeaders = []string{"Time", "Type", "Object", "Reason", "Message"}
+
+// Set the function which watches the events, it is started when the UI runs
+func (ui *UI) SetEventSource(source func(onEvents func([]events.Event)) error) {
+	ui.eventSource = source
+	ui.showEvents = true
+}
+
+func newEventsTable() *tview.Table {
+	table := tview.NewTable().SetFixed(1, 0)
+	table.SetBorder(true).SetTitle(" Events ")
+	setHeaderCells(table, eventsHeaders)
+	return table
+}
+
+// Watch the events in the background until the watch fails
+func (ui *UI) watchEvents() {
+	if ui.eventSource == nil {
+		return
+	}
+	source := ui.eventSource
+	go func() {
+		err := source(func(events []events.Event) {
+			ui.app.QueueUpdateDraw(func() {
+				ui.addEvents(events)
+			})
+		})
+		if err != nil {
+			ui.ShowError(fmt.Errorf("events not watched: %v", err))
+		}
+	}()
+}
+
+// Add or update events, only the newest events are kept
+func (ui *UI) addEvents(added []events.Event) {
+	index := make(map[string]int, len(ui.events))
+	for i, event := range ui.events {
+		index[event.ID] = i
+	}
+	for _, event := range added {
+		if i, ok := index[event.ID]; ok {
+			ui.events[i] = event
+			continue
+		}
+		index[event.ID] = len(ui.events)
+		ui.events = append(ui.events, event)
+	}
+	sort.SliceStable(ui.events, func(i, j int) bool { return ui.events[i].Time.Before(ui.events[j].Time) })
+	if len(ui.events) > maxEvents {
+		ui.events = ui.events[len(ui.events)-maxEvents:]
+	}
+	ui.renderEvents()
+}
+
+// Timeline of the events, newest first
+func (ui *UI) renderEvents() {
+	ui.eventsTable.Clear()
+	setHeaderCells(ui.eventsTable, eventsHeaders)
+	for i := len(ui.events) - 1; i >= 0; i-- {
+		r := len(ui.events) - i
+		event := ui.events[i]
+		color := tcell.ColorWhite
+		if event.Type == "Warning" {
+			color = tcell.ColorRed
+		}
+		reason := event.Reason
+		if event.Count > 1 {
+			reason += fmt.Sprintf(" (x%d)", event.Count)
+		}
+		ui.eventsTable.SetCell(r, 0, tview.NewTableCell(event.Time.Local().Format("15:04:05")))
+		ui.eventsTable.SetCell(r, 1, tview.NewTableCell(event.Type).SetTextColor(color))
+		ui.eventsTable.SetCell(r, 2, tview.NewTableCell(tview.Escape(event.Namespace+" "+event.Object)))
+		ui.eventsTable.SetCell(r, 3, tview.NewTableCell(tview.Escape(reason)).SetTextColor(color))
+		ui.eventsTable.SetCell(r, 4, tview.NewTableCell(tview.Escape(strings.ReplaceAll(event.Message, "\n", " "))).SetExpansion(1))
+	}
+	ui.eventsTable.SetTitle(fmt.Sprintf(" Events [gray](%d)[-] ", len(ui.events)))
+}
+
+func (ui *UI) toggleEvents() {
+	if ui.eventSource == nil {
+		ui.showMessage("events are watched with --events in a cluster")
+		return
+	}
+	ui.showEvents = !ui.showEvents
+	ui.resizeEvents()
+}
+
+func (ui *UI) resizeEvents() {
+	height := 0
+	if ui.showEvents {
+		height = eventsPaneHeight
+	}
+	ui.appFlex.ResizeItem(ui.eventsTable, height, 0)
+}
+
+// Marker of the events between two samples of a history like "! BackOff, Killing +2", empty without events
+func (ui *UI) eventMarker(after, until int64) (string, tcell.Color) {
+	reasons := []string{}
+	seen := make(map[string]struct{})
+	color := tcell.ColorYellow
+	for _, event := range ui.events {
+		if t := event.Time.UnixMilli(); t <= after || t > until {
+			continue
+		}
+		if event.Type == "Warning" {
+			color = tcell.ColorRed
+		}
+		if _, ok := seen[event.Reason]; !ok {
+			seen[event.Reason] = struct{}{}
+			reasons = append(reasons, event.Reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return "", color
+	}
+	marker := "! " + strings.Join(reasons[:min(len(reasons), maxHistoryReasons)], ", ")
+	if len(reasons) > maxHistoryReasons {
+		marker += fmt.Sprintf(" +%d", len(reasons)-maxHistoryReasons)
+	}
+	return marker, color
+}
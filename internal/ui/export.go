@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/export"
+	"github.com/bvankampen/metrics-viewer/internal/history"
+	"github.com/rivo/tview"
+)
+
+var exportScopes = []string{"Current view", "History of the selected series"}
+
+// Set the store with the history of the series, used to export the history of a series
+func (ui *UI) SetHistory(store history.Store) {
+	ui.history = store
+}
+
+func (ui *UI) openExportForm() {
+	format, scope := 0, 0
+	if _, ok := ui.selectedRow(); ok && ui.history != nil {
+		scope = 1
+	}
+	filename := func() string {
+		return fmt.Sprintf("metrics-%s.%s", time.Now().Format("20060102-150405"), export.Extension(export.Formats[format]))
+	}
+
+	form := tview.NewForm()
+	form.AddDropDown("Format", export.Formats, format, nil)
+	form.AddDropDown("Export", exportScopes, scope, nil)
+	form.AddInputField("File", filename(), 50, nil, nil)
+	file := form.GetFormItemByLabel("File").(*tview.InputField)
+	form.GetFormItemByLabel("Format").(*tview.DropDown).SetSelectedFunc(func(_ string, index int) {
+		format = index
+		file.SetText(filename())
+	})
+	form.GetFormItemByLabel("Export").(*tview.DropDown).SetSelectedFunc(func(_ string, index int) {
+		scope = index
+	})
+
+	run := func(toClipboard bool) {
+		var content bytes.Buffer
+		rows, err := ui.exportRows(scope == 1)
+		if err == nil {
+			err = export.Write(&content, export.Formats[format], rows)
+		}
+		if err == nil && toClipboard {
+			err = copyToClipboard(content.Bytes())
+		} else if err == nil {
+			err = os.WriteFile(file.GetText(), content.Bytes(), 0644)
+		}
+		ui.closeModal("export")
+		if err != nil {
+			ui.statusText.SetText(fmt.Sprintf("[red]export failed: %s", tview.Escape(err.Error())))
+			return
+		}
+		if toClipboard {
+			ui.showMessage(fmt.Sprintf("[lightgreen]copied %d rows to the clipboard", len(rows)))
+		} else {
+			ui.showMessage(fmt.Sprintf("[lightgreen]exported %d rows to %s", len(rows), tview.Escape(file.GetText())))
+		}
+	}
+	form.AddButton("Save", func() { run(false) })
+	form.AddButton("Copy", func() { run(true) })
+	form.AddButton("Cancel", func() { ui.closeModal("export") })
+	form.SetCancelFunc(func() { ui.closeModal("export") })
+	form.SetBorder(true).SetTitle(" Export ")
+
+	ui.pages.AddPage("export", modal(form, 80, 11), true, true)
+	ui.app.SetFocus(form)
+}
+
+// The shown rows or the history of the selected series
+func (ui *UI) exportRows(selectedHistory bool) ([]export.Row, error) {
+	if !selectedHistory {
+		rows := []export.Row{}
+		for _, row := range ui.visibleRows() {
+			rows = append(rows, export.Row{Metric: row.MetricName, Type: row.Type, Labels: row.Labels, Value: row.Value})
+		}
+		return rows, nil
+	}
+	row, ok := ui.selectedRow()
+	if !ok {
+		return nil, fmt.Errorf("no series selected")
+	}
+	if ui.history == nil {
+		return nil, fmt.Errorf("no history kept")
+	}
+	samples, err := ui.history.Series(row.ID)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]export.Row, 0, len(samples))
+	for _, sample := range samples {
+		rows = append(rows, export.Row{
+			Metric: row.MetricName,
+			Type:   row.Type,
+			Labels: row.Labels,
+			Value:  strconv.FormatFloat(sample.Value, 'f', -1, 64),
+			Time:   sample.Time,
+		})
+	}
+	return rows, nil
+}
+
+// Rows as shown: filtered, sorted, without hidden stale series and only the members of a drilled down group
+func (ui *UI) visibleRows() []TableRow {
+	rows := ui.currentRows()
+	if len(ui.groupBy) > 0 && ui.drillGroup != nil {
+		rows = ui.drillGroup.members(rows, ui.groupBy)
+	}
+	return rows
+}
+
+// Series of the selected table row or tree node
+func (ui *UI) selectedRow() (TableRow, bool) {
+	var id string
+	if ui.treeMode {
+		if node := ui.tree.GetCurrentNode(); node != nil {
+			id, _ = node.GetReference().(string)
+		}
+	} else if row, _ := ui.table.GetSelection(); row >= 0 {
+		id, _ = ui.table.GetCell(row, 0).GetReference().(string)
+	}
+	for _, row := range ui.rows {
+		if id != "" && row.ID == id {
+			return row, true
+		}
+	}
+	return TableRow{}, false
+}
+
+// Write the OSC52 sequence to the terminal, tview doesn't draw it
+func copyToClipboard(content []byte) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	_, err = tty.WriteString(export.OSC52(content))
+	return err
+}
@@ -2,12 +2,16 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/bvankampen/metrics-viewer/internal/config"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
+const messageTimeout = 5 * time.Second
+
 func createHeader(version string) *tview.TextView {
 	header := tview.NewTextView()
 	header.SetBackgroundColor(tcell.ColorDarkCyan)
@@ -22,7 +26,18 @@ func createFooter() *tview.TextView {
 	footer.SetDynamicColors(true)
 	footer.SetBackgroundColor(tcell.ColorDarkCyan)
 	footerText := "[yellow]q:[white] Quit " +
-		"[yellow]/:[white] Filter "
+		"[yellow]/:[white] Filter " +
+		"[yellow]o/O:[white] Sort " +
+		"[yellow]1-9:[white] Views " +
+		"[yellow]c:[white] Columns " +
+		"[yellow]g:[white] Group by " +
+		"[yellow]t:[white] Tree " +
+		"[yellow]s:[white] Stale " +
+		"[yellow]a:[white] APF " +
+		"[yellow]p:[white] Targets " +
+		"[yellow]e:[white] Export " +
+		"[yellow]v:[white] Events " +
+		"[yellow]?:[white] Keys "
 	footer.SetText(footerText)
 	return footer
 }
@@ -35,11 +50,57 @@ func (ui *UI) updateFilterFlex() {
 	if ui.filterText != "" {
 		filter = ui.filterText
 	}
-	text.SetText(fmt.Sprintf("[yellow]Filter: [lightblue]%s", filter))
+	status := fmt.Sprintf("[yellow]Filter: [lightblue]%s", filter)
+	if ui.sourceName != "" {
+		status = fmt.Sprintf("[yellow]Source: [lightblue]%s %s", tview.Escape(ui.sourceName), status)
+	} else if !ui.target.IsAPIServer() {
+		status = fmt.Sprintf("[yellow]Target: [lightblue]%s %s", ui.target, status)
+	}
+	order := "asc"
+	if !ui.sortAsc {
+		order = "desc"
+	}
+	status += fmt.Sprintf(" [yellow]Sort: [lightblue]%s %s", config.SortColumns[ui.sortColumn], order)
+	if len(ui.groupBy) > 0 {
+		status += fmt.Sprintf(" [yellow]Group: [lightblue]%s", strings.Join(ui.groupBy, ","))
+	}
+	if !ui.showStale {
+		status += " [yellow]Stale: [lightblue]hidden"
+	}
+	if ui.drillGroup != nil {
+		status += fmt.Sprintf(" [yellow]In:[lightblue]%s", labelsToString(ui.drillGroup.Labels))
+	}
+	text.SetText(status)
 	ui.filterFlex.Clear()
 	ui.filterFlex.AddItem(text, 0, 1, false)
 }
 
+// Show an error in the status bar until the next message
+func (ui *UI) ShowError(err error) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.statusText.SetText(fmt.Sprintf("[red]%s", tview.Escape(err.Error())))
+	})
+}
+
+// Show a message in the status bar for a few seconds
+func (ui *UI) ShowMessage(message string) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.showMessage(fmt.Sprintf("[lightgreen]%s", tview.Escape(message)))
+	})
+}
+
+// Like ShowMessage, from the UI goroutine and with colors
+func (ui *UI) showMessage(text string) {
+	ui.statusText.SetText(text)
+	time.AfterFunc(messageTimeout, func() {
+		ui.app.QueueUpdateDraw(func() {
+			if ui.statusText.GetText(false) == text {
+				ui.statusText.SetText("")
+			}
+		})
+	})
+}
+
 func (ui *UI) updateLastUpdate() {
 	ui.lastUpdateFlex.Clear()
 	ui.lastUpdateFlex.SetBackgroundColor(tcell.ColorDarkCyan)
@@ -67,17 +128,38 @@ func (ui *UI) appPage() *tview.Flex {
 	ui.filterFlex = tview.NewFlex().SetDirection(tview.FlexColumn)
 	ui.lastUpdateFlex = tview.NewFlex()
 
+	ui.viewsText = tview.NewTextView()
+	ui.viewsText.SetDynamicColors(true)
+	ui.viewsText.SetBackgroundColor(tcell.ColorDarkCyan)
+
 	flex.AddItem(headerflex, 1, 1, false)
-	flex.AddItem(ui.table, 0, 1, true)
+	flex.AddItem(ui.viewsText, 1, 1, false)
+	ui.body.AddPage("table", ui.table, true, true)
+	ui.body.AddPage("tree", ui.tree, true, false)
+	ui.body.AddPage("apf", ui.apfView, true, false)
+	ui.body.AddPage("history", ui.historyTable, true, false)
+
+	flex.AddItem(ui.body, 0, 1, true)
+	flex.AddItem(ui.chartsFlex, 0, 0, false)
+	flex.AddItem(ui.eventsTable, 0, 0, false)
 	flex.AddItem(bottomflex, 1, 1, false)
+	ui.appFlex = flex
+	ui.resizeEvents()
+	ui.renderCharts()
 
 	headerflex.AddItem(createHeader(ui.ctx.App.Version), 0, 3, false)
 	headerflex.AddItem(ui.lastUpdateFlex, 0, 1, false)
+	ui.statusText = tview.NewTextView()
+	ui.statusText.SetDynamicColors(true)
+	ui.statusText.SetBackgroundColor(tcell.ColorDarkCyan)
+
 	bottomflex.AddItem(createFooter(), 0, 2, false)
+	bottomflex.AddItem(ui.statusText, 0, 1, false)
 	bottomflex.AddItem(ui.filterFlex, 0, 1, false)
 
 	ui.filterText = ""
 	ui.updateFilterFlex()
+	ui.updateViewsBar()
 	ui.updateLastUpdate()
 
 	return flex
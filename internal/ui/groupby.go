@@ -0,0 +1,176 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Collapse rows per metric by the values of the group by labels, keeping the row order
+func groupRows(rows []TableRow, groupBy []string) []*tableGroup {
+	groups := []*tableGroup{}
+	index := make(map[string]*tableGroup)
+	for _, row := range rows {
+		key := groupKey(row, groupBy)
+		group, ok := index[key]
+		if !ok {
+			labels := make(map[string]string, len(groupBy))
+			for _, l := range groupBy {
+				labels[l] = row.Labels[l]
+			}
+			group = &tableGroup{
+				MetricName: row.MetricName,
+				Type:       row.Type,
+				Labels:     labels,
+				Min:        math.Inf(1),
+				Max:        math.Inf(-1),
+			}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		value, err := strconv.ParseFloat(row.Value, 64)
+		if err != nil {
+			continue
+		}
+		group.Count++
+		group.Sum += value
+		group.Min = math.Min(group.Min, value)
+		group.Max = math.Max(group.Max, value)
+	}
+	return groups
+}
+
+func groupKey(row TableRow, groupBy []string) string {
+	var builder strings.Builder
+	builder.WriteString(row.MetricName)
+	for _, l := range groupBy {
+		builder.WriteString("\x00")
+		builder.WriteString(row.Labels[l])
+	}
+	return builder.String()
+}
+
+func (g *tableGroup) Avg() float64 {
+	if g.Count == 0 {
+		return 0
+	}
+	return g.Sum / float64(g.Count)
+}
+
+// Rows that are part of this group
+func (g *tableGroup) members(rows []TableRow, groupBy []string) []TableRow {
+	members := []TableRow{}
+	for _, row := range rows {
+		if row.MetricName != g.MetricName {
+			continue
+		}
+		match := true
+		for _, l := range groupBy {
+			if row.Labels[l] != g.Labels[l] {
+				match = false
+				break
+			}
+		}
+		if match {
+			members = append(members, row)
+		}
+	}
+	return members
+}
+
+func (ui *UI) renderGroupTable() {
+	ui.table.Clear()
+	ui.table.SetFixed(1, 0)
+	ui.table.SetSelectable(true, false)
+
+	headerStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDarkBlue)
+	columnHeaderStyle := tcell.StyleDefault.Foreground(tcell.ColorYellow).Background(tcell.ColorDarkCyan)
+
+	columns := []string{"group: " + strings.Join(ui.groupBy, ","), "count", "sum", "avg", "min", "max"}
+	for i, c := range columns {
+		ui.table.SetCell(0, i, tview.NewTableCell(c).
+			SetStyle(columnHeaderStyle).
+			SetSelectable(false).
+			SetExpansion(expansionForColumn(i)))
+	}
+
+	rowIndex := 1
+	var currentMetric string
+	for _, group := range groupRows(ui.currentRows(), ui.groupBy) {
+		if group.MetricName != currentMetric {
+			ui.table.SetCell(rowIndex, 0, tview.NewTableCell(fmt.Sprintf("%s [gray](%s)", group.MetricName, group.Type)).
+				SetStyle(headerStyle).
+				SetSelectable(false))
+			for i := 1; i < len(columns); i++ {
+				ui.table.SetCell(rowIndex, i, tview.NewTableCell("").
+					SetStyle(headerStyle).
+					SetSelectable(false))
+			}
+			rowIndex++
+			currentMetric = group.MetricName
+		}
+		ui.table.SetCell(rowIndex, 0, tview.NewTableCell(labelsToString(group.Labels)).SetReference(group))
+		ui.table.SetCell(rowIndex, 1, tview.NewTableCell(strconv.Itoa(group.Count)))
+		for i, v := range []float64{group.Sum, group.Avg(), group.Min, group.Max} {
+			text := "-"
+			if group.Count > 0 {
+				text = formatValue(strconv.FormatFloat(v, 'f', -1, 64))
+			}
+			ui.table.SetCell(rowIndex, i+2, tview.NewTableCell(text))
+		}
+		rowIndex++
+	}
+}
+
+func expansionForColumn(column int) int {
+	if column == 0 {
+		return 2
+	}
+	return 1
+}
+
+// Drill into the member series of the selected group, or show the history of the selected series
+func (ui *UI) selectRow(row, column int) {
+	if len(ui.groupBy) == 0 || ui.drillGroup != nil {
+		if selected, ok := ui.selectedRow(); ok {
+			ui.openHistory(selected)
+		}
+		return
+	}
+	if group, ok := ui.table.GetCell(row, 0).GetReference().(*tableGroup); ok {
+		ui.drillGroup = group
+		ui.renderTable()
+		ui.updateFilterFlex()
+		ui.table.ScrollToBeginning()
+	}
+}
+
+func (ui *UI) openGroupByInput() {
+	inputField := tview.NewInputField()
+	inputField.
+		SetLabel("Group by (labels): ").
+		SetText(strings.Join(ui.groupBy, ",")).
+		SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEnter {
+				ui.groupBy = splitLabels(inputField.GetText())
+				ui.drillGroup = nil
+				ui.renderTable()
+			}
+			ui.updateFilterFlex()
+			ui.app.SetRoot(ui.pages, true).SetFocus(ui.bodyPrimitive())
+		})
+	s := tcell.Style.Background(tcell.Style{}, tcell.ColorDarkCyan)
+	inputField.SetLabelStyle(s)
+	ui.filterFlex.Clear()
+	ui.filterFlex.SetBackgroundColor(tcell.ColorDarkCyan)
+	ui.filterFlex.AddItem(inputField, 0, 1, true)
+	ui.app.SetRoot(ui.pages, true).SetFocus(inputField)
+}
+
+func splitLabels(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' })
+}
@@ -0,0 +1,39 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Keys of the main page as shown by ?, keep in sync with the keys table of the README
+var helpKeys = [][2]string{
+	{"q", "Quit"},
+	{"/", "Filter"},
+	{"o O", "Sort on the next column (metric, labels, value), reverse the order"},
+	{"1-9 Tab Shift-Tab", "Switch view"},
+	{"c", "Toggle columnar mode, [ ] { } - + h H change the columns"},
+	{"g", "Group by labels"},
+	{"t", "Toggle tree mode"},
+	{"s", "Show or hide stale series"},
+	{"a", "Show or hide the APF dashboard"},
+	{"p", "Pick the target to scrape"},
+	{"e", "Export the view or the history of the selected series"},
+	{"v", "Show or hide the events timeline"},
+	{"Enter", "Show the history of the selected series, Esc goes back"},
+	{"?", "Show these keys"},
+}
+
+func (ui *UI) openHelp() {
+	var builder strings.Builder
+	for _, key := range helpKeys {
+		builder.WriteString(fmt.Sprintf("[yellow]%-18s[white] %s\n", key[0], tview.Escape(key[1])))
+	}
+	text := tview.NewTextView().SetDynamicColors(true).SetText(builder.String())
+	text.SetBorder(true).SetTitle(" Keys (Esc closes) ")
+	text.SetDoneFunc(func(tcell.Key) { ui.closeModal("help") })
+	ui.pages.AddPage("help", modal(text, 90, len(helpKeys)+2), true, true)
+	ui.app.SetFocus(text)
+}
@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/history"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+var historyHeaders = []string{"Time", "Value", "Change"}
+
+func newHistoryTable() *tview.Table {
+	table := tview.NewTable().SetFixed(1, 0).SetSelectable(true, false)
+	table.SetBorder(true)
+	return table
+}
+
+// Show the history of a series, newest sample first
+func (ui *UI) openHistory(row TableRow) {
+	if ui.history == nil {
+		return
+	}
+	ui.historyMode = true
+	ui.historyTable.Clear()
+	ui.historyTable.SetTitle(fmt.Sprintf(" %s%s [gray](loading)[-] ", row.MetricName, labelsToString(row.Labels)))
+	ui.body.SwitchToPage("history")
+	ui.app.SetFocus(ui.historyTable)
+
+	store := ui.history
+	go func() {
+		samples, err := store.Series(row.ID)
+		ui.app.QueueUpdateDraw(func() {
+			if !ui.historyMode {
+				return
+			}
+			if err != nil {
+				ui.historyTable.SetTitle(fmt.Sprintf(" %s%s [red]%s[-] ", row.MetricName, labelsToString(row.Labels), tview.Escape(err.Error())))
+				return
+			}
+			ui.renderHistory(row, samples)
+		})
+	}()
+}
+
+func (ui *UI) renderHistory(row TableRow, samples []history.Sample) {
+	span := ""
+	if len(samples) > 1 {
+		span = ", " + samples[len(samples)-1].Time.Sub(samples[0].Time).Round(time.Second).String()
+	}
+	ui.historyTable.SetTitle(fmt.Sprintf(" %s%s [gray](%d samples%s)[-] ", row.MetricName, labelsToString(row.Labels), len(samples), span))
+	headers := historyHeaders
+	if ui.eventSource != nil {
+		headers = append(headers[:len(headers):len(headers)], "Events")
+	}
+	setHeaderCells(ui.historyTable, headers)
+	for i := len(samples) - 1; i >= 0; i-- {
+		r := len(samples) - i
+		sample := samples[i]
+		ui.historyTable.SetCell(r, 0, tview.NewTableCell(sample.Time.Local().Format("2006-01-02 15:04:05")))
+		ui.historyTable.SetCell(r, 1, tview.NewTableCell(formatValue(strconv.FormatFloat(sample.Value, 'f', -1, 64))).SetAlign(tview.AlignRight))
+		change := tview.NewTableCell("").SetAlign(tview.AlignRight)
+		if i > 0 {
+			switch delta := sample.Value - samples[i-1].Value; {
+			case delta > 0:
+				change.SetText("+" + formatValue(strconv.FormatFloat(delta, 'f', -1, 64))).SetTextColor(tcell.ColorGreen)
+			case delta < 0:
+				change.SetText(formatValue(strconv.FormatFloat(delta, 'f', -1, 64))).SetTextColor(tcell.ColorRed)
+			}
+		}
+		ui.historyTable.SetCell(r, 2, change)
+		if ui.eventSource != nil {
+			after := sample.Time.UnixMilli() // the events before the first sample aren't in the history
+			if i > 0 {
+				after = samples[i-1].Time.UnixMilli()
+			}
+			marker, color := ui.eventMarker(after, sample.Time.UnixMilli())
+			ui.historyTable.SetCell(r, 3, tview.NewTableCell(tview.Escape(marker)).SetTextColor(color))
+		}
+	}
+	ui.historyTable.ScrollToBeginning()
+}
+
+func (ui *UI) closeHistory() {
+	ui.historyMode = false
+	switch {
+	case ui.apfMode:
+		ui.body.SwitchToPage("apf")
+	case ui.treeMode:
+		ui.body.SwitchToPage("tree")
+	default:
+		ui.body.SwitchToPage("table")
+	}
+	ui.app.SetFocus(ui.bodyPrimitive())
+}
@@ -7,11 +7,16 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/urfave/cli"
 )
 
+const maxFilterHistory = 50
+
 func NewAppUI(ctx *cli.Context) *UI {
 	app := tview.NewApplication()
 	table := tview.NewTable().
@@ -20,26 +25,42 @@ func NewAppUI(ctx *cli.Context) *UI {
 
 	pages := tview.NewPages()
 
-	return &UI{
-		app:        app,
-		table:      table,
-		pages:      pages,
-		sortAsc:    true,
-		ctx:        ctx,
-		sortColumn: 0,
+	ui := &UI{
+		app:          app,
+		table:        table,
+		pages:        pages,
+		body:         tview.NewPages(),
+		sortAsc:      true,
+		showStale:    true,
+		ctx:          ctx,
+		sortColumn:   0,
+		treeExpanded: make(map[string]bool),
+		views:        []config.View{{Name: allViewName}},
+		viewStates:   make(map[string]viewState),
+		target:       discovery.APIServer,
+		chartsFlex:   tview.NewFlex(),
+		chartSeries:  make(map[string]*chartSeries),
 	}
+	table.SetSelectedFunc(ui.selectRow)
+	ui.tree = newTreeView(ui)
+	ui.apfView = newAPFView(ui)
+	ui.historyTable = newHistoryTable()
+	ui.eventsTable = newEventsTable()
+	return ui
 }
 
 func (ui *UI) Run(observeChan <-chan interface{}) {
 	go func() {
 		for data := range observeChan {
-			ui.updateTable(data)
-			ui.app.Draw()
+			ui.app.QueueUpdateDraw(func() {
+				ui.updateTable(data)
+			})
 		}
 	}()
 
 	ui.app.SetInputCapture(ui.handleKeyEvents)
 	ui.pages.AddPage("main", ui.appPage(), true, true)
+	ui.watchEvents()
 
 	if err := ui.app.SetRoot(ui.pages, true).Run(); err != nil {
 		panic(err)
@@ -63,14 +84,62 @@ func (ui *UI) updateTable(data interface{}) {
 		return
 	}
 
+	if data, ok := dataMap["data"].(realtimedata.RealTimeData); ok {
+		ui.data = data
+		ui.recordCharts()
+	}
+
+	ui.rows = uiData
+	ui.renderTable()
+	ui.renderAPF()
+	ui.updateLastUpdate()
+}
+
+func (ui *UI) renderTable() {
+	if ui.treeMode {
+		ui.renderTree()
+		return
+	}
+	rows := ui.currentRows()
+	if len(ui.groupBy) > 0 {
+		if ui.drillGroup == nil {
+			ui.renderGroupTable()
+			return
+		}
+		rows = ui.drillGroup.members(rows, ui.groupBy)
+	}
+	ui.table.SetSelectable(true, false) // the selected series can be exported
+	if ui.columnar {
+		ui.renderColumnarTable(rows)
+		return
+	}
+	ui.renderLabelTable(rows)
+}
+
+// Rows to show, without the stale series unless these are enabled
+func (ui *UI) currentRows() []TableRow {
+	if ui.showStale {
+		return ui.rows
+	}
+	rows := make([]TableRow, 0, len(ui.rows))
+	for _, row := range ui.rows {
+		if row.Stale == 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func (ui *UI) renderLabelTable(rows []TableRow) {
 	ui.table.Clear()
+	ui.table.SetFixed(0, 0)
 	rowIndex := 0
 
 	var currentMetric string
 
 	headerStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDarkBlue)
 
-	for _, row := range uiData {
+	for _, row := range rows {
 		if row.MetricName != currentMetric {
 			ui.table.SetCell(rowIndex, 0, tview.NewTableCell(fmt.Sprintf("%s [gray](%s)", row.MetricName, row.Type)).
 				SetStyle(headerStyle).
@@ -92,12 +161,11 @@ func (ui *UI) updateTable(data interface{}) {
 
 		labelString := labelsToString(row.Labels)
 
-		ui.table.SetCell(rowIndex, 0, tview.NewTableCell(labelString))
+		ui.table.SetCell(rowIndex, 0, tview.NewTableCell(labelString).SetReference(row.ID))
 
-		ui.table.SetCell(rowIndex, 1, tview.NewTableCell(formatValue(row.Value)))
+		ui.table.SetCell(rowIndex, 1, tview.NewTableCell(formatRowValue(row)))
 		rowIndex++
 	}
-	ui.updateLastUpdate()
 }
 
 func formatValue(value string) string {
@@ -113,6 +181,30 @@ func formatValue(value string) string {
 	return newValue
 }
 
+// Value with the change since the previous scrape, coloured green for up and red for down
+func formatRowValue(row TableRow) string {
+	value := formatValue(row.Value)
+	switch {
+	case row.Stale > 0:
+		return fmt.Sprintf("[gray]%s (stale %d)", value, row.Stale)
+	case row.New:
+		return fmt.Sprintf("[aqua]%s (new)", value)
+	}
+	current, err := strconv.ParseFloat(row.Value, 64)
+	if err != nil {
+		return value
+	}
+	previous, err := strconv.ParseFloat(row.PreviousValue, 64)
+	if err != nil || previous == current {
+		return value
+	}
+	delta := formatValue(strconv.FormatFloat(current-previous, 'f', -1, 64))
+	if current > previous {
+		return fmt.Sprintf("[green]%s ▲ +%s", value, delta)
+	}
+	return fmt.Sprintf("[red]%s ▼ %s", value, delta)
+}
+
 func labelsToString(labels map[string]string) string {
 	keys := make([]string, 0, len(labels))
 	for key := range labels {
@@ -140,39 +232,131 @@ func (ui *UI) SetSortHandler(handler func(column int, ascending bool)) {
 	ui.sortHandler = handler
 }
 
+// Name of the data source if it isn't the apiserver scraper, like a file
+func (ui *UI) SetSourceName(name string) {
+	ui.sourceName = name
+}
+
 func (ui *UI) handleKeyEvents(event *tcell.EventKey) *tcell.EventKey {
+	if _, ok := ui.app.GetFocus().(*tview.InputField); ok { // don't steal keys from input fields
+		return event
+	}
+	if ui.modalOpen() {
+		return event
+	}
+	if ui.historyMode {
+		switch {
+		case event.Rune() == 'q':
+			ui.app.Stop()
+		case event.Key() == tcell.KeyEscape:
+			ui.closeHistory()
+			return nil
+		}
+		return event // the other keys scroll through the history
+	}
+	if ui.apfMode {
+		if event.Rune() == 'q' {
+			ui.app.Stop()
+		}
+		if ui.handleAPFKeyEvents(event) {
+			return nil
+		}
+		return event // the other keys only move through the tables
+	}
+	if ui.handleViewKeyEvents(event) {
+		return nil
+	}
+	if ui.columnar && !ui.treeMode && ui.handleColumnKeyEvents(event) {
+		return nil
+	}
+	if event.Key() == tcell.KeyEscape && ui.drillGroup != nil {
+		ui.drillGroup = nil
+		ui.renderTable()
+		ui.updateFilterFlex()
+		return nil
+	}
 	switch event.Rune() {
 	case 'q':
 		ui.app.Stop()
-	case '1':
-		ui.ToggleSort(0)
-	case '2':
-		ui.ToggleSort(1)
-	case '3':
-		ui.ToggleSort(2)
+	case 'o':
+		ui.CycleSort()
+	case 'O':
+		ui.ReverseSort()
+	case 'c':
+		ui.columnar = !ui.columnar
+		ui.renderTable()
+		return nil
 	case '/':
 		ui.openFilterInput()
 		return nil
+	case 'g':
+		ui.openGroupByInput()
+		return nil
+	case 't':
+		ui.toggleTree()
+		return nil
+	case 'a':
+		ui.toggleAPF()
+		return nil
+	case 'p':
+		ui.openTargetPicker()
+		return nil
+	case 'e':
+		ui.openExportForm()
+		return nil
+	case 'v':
+		ui.toggleEvents()
+		return nil
+	case '?':
+		ui.openHelp()
+		return nil
+	case 's':
+		ui.showStale = !ui.showStale
+		ui.renderTable()
+		ui.updateFilterFlex()
+		return nil
 	}
 	return event
 }
 
 func (ui *UI) openFilterInput() {
 	inputField := tview.NewInputField()
+	historyIndex := len(ui.filterHistory)
 	inputField.
-		SetLabel("Filter (regex): ").
+		SetLabel("Filter: ").
 		SetText(ui.filterText).
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
 				text := inputField.GetText()
 				ui.filterText = text
+				ui.addFilterHistory(text)
 				if ui.filterHandler != nil {
 					ui.filterHandler(text)
 				}
 			}
 			ui.updateFilterFlex()
-			ui.app.SetRoot(ui.pages, true).SetFocus(ui.table)
+			ui.app.SetRoot(ui.pages, true).SetFocus(ui.bodyPrimitive())
 		})
+	inputField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp:
+			if historyIndex > 0 {
+				historyIndex--
+				inputField.SetText(ui.filterHistory[historyIndex])
+			}
+			return nil
+		case tcell.KeyDown:
+			if historyIndex < len(ui.filterHistory)-1 {
+				historyIndex++
+				inputField.SetText(ui.filterHistory[historyIndex])
+			} else {
+				historyIndex = len(ui.filterHistory)
+				inputField.SetText("")
+			}
+			return nil
+		}
+		return event
+	})
 	s := tcell.Style.Background(tcell.Style{}, tcell.ColorDarkCyan)
 	inputField.SetLabelStyle(s)
 	ui.filterFlex.Clear()
@@ -181,9 +365,37 @@ func (ui *UI) openFilterInput() {
 	ui.app.SetRoot(ui.pages, true).SetFocus(inputField)
 }
 
-func (ui *UI) ToggleSort(column int) {
+// Remember a filter for the up/down keys, the most recent filter is last
+func (ui *UI) addFilterHistory(text string) {
+	if text == "" {
+		return
+	}
+	for i, f := range ui.filterHistory {
+		if f == text {
+			ui.filterHistory = append(ui.filterHistory[:i], ui.filterHistory[i+1:]...)
+			break
+		}
+	}
+	ui.filterHistory = append(ui.filterHistory, text)
+	if len(ui.filterHistory) > maxFilterHistory {
+		ui.filterHistory = ui.filterHistory[1:]
+	}
+}
+
+// Sort on the next column: metric, labels, value
+func (ui *UI) CycleSort() {
+	ui.sortColumn = (ui.sortColumn + 1) % len(config.SortColumns)
+	ui.applySort()
+}
+
+func (ui *UI) ReverseSort() {
 	ui.sortAsc = !ui.sortAsc
+	ui.applySort()
+}
+
+func (ui *UI) applySort() {
 	if ui.sortHandler != nil {
-		ui.sortHandler(column, ui.sortAsc)
+		ui.sortHandler(ui.sortColumn, ui.sortAsc)
 	}
+	ui.updateFilterFlex()
 }
@@ -0,0 +1,409 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bvankampen/metrics-viewer/internal/alerts"
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/events"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/urfave/cli"
+)
+
+func newTestUI() *UI {
+	app := cli.NewApp()
+	app.Version = "test"
+	ui := NewAppUI(cli.NewContext(app, nil, nil))
+	ui.pages.AddPage("main", ui.appPage(), true, true)
+	return ui
+}
+
+// Draw the pages on a simulated screen and return its lines
+func render(ui *UI, width, height int) []string {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	screen.Init()
+	screen.SetSize(width, height)
+	ui.pages.SetRect(0, 0, width, height)
+	ui.pages.Draw(screen)
+	screen.Show()
+	cells, _, _ := screen.GetContents()
+	lines := make([]string, height)
+	for y := 0; y < height; y++ {
+		var line strings.Builder
+		for x := 0; x < width; x++ {
+			runes := cells[y*width+x].Runes
+			if len(runes) == 0 {
+				line.WriteRune(' ')
+				continue
+			}
+			line.WriteString(string(runes))
+		}
+		lines[y] = strings.TrimRight(line.String(), " ")
+	}
+	return lines
+}
+
+func contains(lines []string, text string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+var testRows = []TableRow{
+	{ID: "seats1", MetricName: "apiserver_flowcontrol_current_limit_seats", Type: "gauge", Labels: map[string]string{"priority_level": "catch-all"}, Value: "13", PreviousValue: "10"},
+	{ID: "seats2", MetricName: "apiserver_flowcontrol_current_limit_seats", Type: "gauge", Labels: map[string]string{"priority_level": "workload-low"}, Value: "245", New: true},
+	{ID: "queue1", MetricName: "apiserver_flowcontrol_current_inqueue_requests", Type: "gauge", Labels: map[string]string{"priority_level": "workload-low"}, Value: "3", Stale: 2},
+}
+
+func TestRenderTable(t *testing.T) {
+	ui := newTestUI()
+	ui.updateTable(map[string]interface{}{"uiData": testRows})
+	lines := render(ui, 240, 20)
+	for _, text := range []string{
+		"apiserver_flowcontrol_current_limit_seats (gauge)",
+		"priority_level: catch-all",
+		"245",
+		"apiserver_flowcontrol_current_inqueue_requests (gauge)",
+		"Last Update:",
+	} {
+		if !contains(lines, text) {
+			t.Errorf("expected %q on the screen:\n%s", text, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestRenderStatus(t *testing.T) {
+	ui := newTestUI()
+	ui.SetSourceName("demo")
+	ui.groupBy = []string{"priority_level"}
+	ui.showStale = false
+	ui.updateFilterFlex()
+	ui.updateTable(map[string]interface{}{"uiData": testRows})
+	lines := render(ui, 320, 20)
+	for _, text := range []string{"Source: demo", "Sort: metric asc", "Group: priority_level", "workload-low"} {
+		if !contains(lines, text) {
+			t.Errorf("expected %q on the screen:\n%s", text, strings.Join(lines, "\n"))
+		}
+	}
+	if contains(lines, "apiserver_flowcontrol_current_inqueue_requests") {
+		t.Errorf("expected the stale series to be hidden:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ui := newTestUI()
+	start := time.Unix(1700000000, 0)
+	ui.addEvents([]events.Event{
+		{ID: "a", Time: start.Add(2 * time.Second), Type: "Normal", Reason: "Pulled", Object: "Pod/web-1", Count: 1},
+		{ID: "b", Time: start.Add(time.Second), Type: "Warning", Reason: "BackOff", Object: "Pod/web-0", Count: 1},
+	})
+	ui.addEvents([]events.Event{{ID: "b", Time: start.Add(3 * time.Second), Type: "Warning", Reason: "BackOff", Object: "Pod/web-0", Count: 4}})
+	if len(ui.events) != 2 || ui.events[1].ID != "b" {
+		t.Fatalf("expected the updated event last, got %+v", ui.events)
+	}
+	if got := ui.eventsTable.GetCell(1, 3).Text; got != "BackOff (x4)" {
+		t.Errorf("expected the newest event first, got %q", got)
+	}
+	marker, color := ui.eventMarker(start.UnixMilli(), start.Add(3*time.Second).UnixMilli())
+	if marker != "! Pulled, BackOff" || color != tcell.ColorRed {
+		t.Errorf("unexpected marker %q %v", marker, color)
+	}
+	if marker, _ := ui.eventMarker(start.Add(3*time.Second).UnixMilli(), start.Add(time.Minute).UnixMilli()); marker != "" {
+		t.Errorf("expected no marker, got %q", marker)
+	}
+}
+
+func TestEventsPane(t *testing.T) {
+	ui := newTestUI()
+	ui.SetEventSource(func(func([]events.Event)) error { return nil })
+	ui.resizeEvents()
+	start := time.Unix(1700000000, 0)
+	added := []events.Event{}
+	for i := 0; i < maxEvents+5; i++ {
+		added = append(added, events.Event{ID: strconv.Itoa(i), Time: start.Add(time.Duration(i) * time.Second), Type: "Normal", Reason: "Scheduled", Object: "Pod/web-" + strconv.Itoa(i)})
+	}
+	added[len(added)-1].Type, added[len(added)-1].Reason = "Warning", "FailedMount"
+	ui.addEvents(added)
+	if len(ui.events) != maxEvents || ui.events[0].ID != "5" {
+		t.Errorf("expected the newest %d events, got %d starting at %s", maxEvents, len(ui.events), ui.events[0].ID)
+	}
+
+	lines := render(ui, 240, 30)
+	for _, text := range []string{"Events (500)", "FailedMount", fmt.Sprintf("Pod/web-%d", maxEvents+3)} {
+		if !contains(lines, text) {
+			t.Errorf("expected %q on the screen:\n%s", text, strings.Join(lines, "\n"))
+		}
+	}
+	ui.toggleEvents()
+	if lines := render(ui, 240, 30); contains(lines, "FailedMount") {
+		t.Errorf("expected the events to be hidden:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestViewKeys(t *testing.T) {
+	ui := newTestUI()
+	ui.SetViews([]config.View{{Name: "apf"}, {Name: "etcd", Sort: config.ViewSort{Column: "value", Descending: true}}})
+	ui.updateViewsBar()
+	sorted := []string{}
+	ui.SetSortHandler(func(column int, asc bool) { sorted = append(sorted, fmt.Sprint(column, asc)) })
+
+	ui.handleKeyEvents(tcell.NewEventKey(tcell.KeyRune, '3', tcell.ModNone))
+	if ui.currentView != 2 || ui.sortColumn != 2 || ui.sortAsc {
+		t.Errorf("expected 3 to select the etcd view with its sort preset, got view %d sort %d %v", ui.currentView, ui.sortColumn, ui.sortAsc)
+	}
+	ui.handleKeyEvents(tcell.NewEventKey(tcell.KeyRune, '9', tcell.ModNone))
+	if ui.currentView != 2 {
+		t.Errorf("expected a key without a view to be ignored, got view %d", ui.currentView)
+	}
+	ui.handleKeyEvents(tcell.NewEventKey(tcell.KeyRune, 'o', tcell.ModNone))
+	ui.handleKeyEvents(tcell.NewEventKey(tcell.KeyRune, 'O', tcell.ModNone))
+	if got := strings.Join(sorted, ","); !strings.HasSuffix(got, "0 false,0 true") {
+		t.Errorf("expected o to sort on the next column and O to reverse, got %s", got)
+	}
+	ui.handleKeyEvents(tcell.NewEventKey(tcell.KeyRune, '1', tcell.ModNone))
+	if ui.currentView != 0 {
+		t.Errorf("expected 1 to select the All view, got view %d", ui.currentView)
+	}
+
+	ui.handleKeyEvents(key('?'))
+	if lines := render(ui, 200, 40); !contains(lines, "Sort on the next column") || !contains(lines, "1-9 Tab Shift-Tab") {
+		t.Errorf("expected the keys to be shown:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func key(r rune) *tcell.EventKey {
+	return tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone)
+}
+
+// Index of the first line with the text and the column of the text in it, -1 if it isn't shown
+func find(lines []string, text string) (int, int) {
+	for i, line := range lines {
+		if column := strings.Index(line, text); column >= 0 {
+			return i, column
+		}
+	}
+	return -1, -1
+}
+
+var flowRows = []TableRow{
+	{ID: "d1", MetricName: "apiserver_flowcontrol_dispatched_requests_total", Type: "counter", Labels: map[string]string{"priority_level": "workload-low", "flow_schema": "service-accounts"}, Value: "10"},
+	{ID: "d2", MetricName: "apiserver_flowcontrol_dispatched_requests_total", Type: "counter", Labels: map[string]string{"priority_level": "workload-low", "flow_schema": "kube-scheduler"}, Value: "30"},
+	{ID: "d3", MetricName: "apiserver_flowcontrol_dispatched_requests_total", Type: "counter", Labels: map[string]string{"priority_level": "global-default", "flow_schema": "global-default"}, Value: "5"},
+}
+
+func TestColumnar(t *testing.T) {
+	ui := newTestUI()
+	ui.updateTable(map[string]interface{}{"uiData": flowRows})
+	ui.handleKeyEvents(key('c'))
+	lines := render(ui, 200, 20)
+	header, flow := find(lines, "flow_schema")
+	_, level := find(lines, "priority_level")
+	if header < 0 || flow > level || !contains(lines, "value") {
+		t.Fatalf("expected the label keys as sorted columns:\n%s", strings.Join(lines, "\n"))
+	}
+	if row, column := find(lines, "kube-scheduler"); row < 0 || column != flow || !strings.Contains(lines[row], "workload-low") || !strings.Contains(lines[row], "30") {
+		t.Errorf("expected a series per row with its labels under the columns:\n%s", strings.Join(lines, "\n"))
+	}
+
+	ui.handleKeyEvents(key('}')) // move flow_schema to the right
+	lines = render(ui, 200, 20)
+	if _, flow := find(lines, "flow_schema"); flow < level {
+		t.Errorf("expected flow_schema after priority_level:\n%s", strings.Join(lines, "\n"))
+	}
+	if ui.columnCursor != 1 {
+		t.Errorf("expected the cursor to move with the column, got %d", ui.columnCursor)
+	}
+	ui.handleKeyEvents(key('+'))
+	if ui.columns[1].Width == 0 {
+		t.Errorf("expected the column to get a width, got %+v", ui.columns[1])
+	}
+	ui.handleKeyEvents(key('h'))
+	if lines := render(ui, 200, 20); contains(lines, "flow_schema") || contains(lines, "kube-scheduler") || !contains(lines, "workload-low") {
+		t.Errorf("expected flow_schema to be hidden:\n%s", strings.Join(lines, "\n"))
+	}
+	ui.handleKeyEvents(key('H'))
+	if lines := render(ui, 200, 20); !contains(lines, "kube-scheduler") {
+		t.Errorf("expected the hidden column to be shown again:\n%s", strings.Join(lines, "\n"))
+	}
+	ui.handleKeyEvents(key('c'))
+	if lines := render(ui, 200, 20); ui.columnar || !contains(lines, "flow_schema: kube-scheduler") {
+		t.Errorf("expected the labels in one column again:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	ui := newTestUI()
+	ui.groupBy = []string{"priority_level"}
+	ui.updateTable(map[string]interface{}{"uiData": flowRows})
+	lines := render(ui, 200, 20)
+	for label, expected := range map[string]string{
+		"priority_level: workload-low":   "2 40 20 10 30", // count, sum, avg, min, max
+		"priority_level: global-default": "1 5 5 5 5",
+	} {
+		row, column := find(lines, label)
+		if row < 0 {
+			t.Errorf("expected a group for %s:\n%s", label, strings.Join(lines, "\n"))
+			continue
+		}
+		if got := strings.Join(strings.Fields(lines[row][column+len(label):]), " "); got != expected {
+			t.Errorf("%s: expected %s, got %s", label, expected, got)
+		}
+	}
+	if contains(lines, "kube-scheduler") {
+		t.Errorf("expected the series to be collapsed into groups:\n%s", strings.Join(lines, "\n"))
+	}
+
+	ui.selectRow(2, 0) // the workload-low group under the metric
+	lines = render(ui, 200, 20)
+	if !contains(lines, "kube-scheduler") || !contains(lines, "service-accounts") || contains(lines, "global-default") {
+		t.Errorf("expected the series of the workload-low group:\n%s", strings.Join(lines, "\n"))
+	}
+	ui.handleKeyEvents(tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone))
+	if lines := render(ui, 200, 20); ui.drillGroup != nil || !contains(lines, "priority_level: global-default") {
+		t.Errorf("expected Esc to go back to the groups:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestTree(t *testing.T) {
+	ui := newTestUI()
+	rows := append(append([]TableRow{}, flowRows...), testRows...)
+	ui.updateTable(map[string]interface{}{"uiData": rows})
+	ui.handleKeyEvents(key('t'))
+	lines := render(ui, 200, 20)
+	family := "apiserver_flowcontrol_dispatched_requests_total (counter) 3 series, sum 45"
+	familyRow, familyColumn := find(lines, family)
+	if familyRow < 0 || !contains(lines, "apiserver_flowcontrol_current_limit_seats (gauge) 2 series, sum 258") {
+		t.Fatalf("expected a node per metric with its count and sum:\n%s", strings.Join(lines, "\n"))
+	}
+	if contains(lines, "kube-scheduler") {
+		t.Errorf("expected the metrics to be collapsed:\n%s", strings.Join(lines, "\n"))
+	}
+
+	enter := func() {
+		ui.tree.InputHandler()(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), func(tview.Primitive) {})
+	}
+	enter()
+	ui.updateTable(map[string]interface{}{"uiData": rows}) // the expanded metrics stay expanded
+	lines = render(ui, 200, 20)
+	row, column := find(lines, "kube-scheduler")
+	if row != familyRow+2 || column <= familyColumn || !strings.Contains(lines[row], "= 30") {
+		t.Errorf("expected the series nested under the metric:\n%s", strings.Join(lines, "\n"))
+	}
+	if contains(lines, "priority_level: catch-all") {
+		t.Errorf("expected the other metric to stay collapsed:\n%s", strings.Join(lines, "\n"))
+	}
+	enter()
+	if lines := render(ui, 200, 20); contains(lines, "kube-scheduler") {
+		t.Errorf("expected the metric to be collapsed again:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestAlertsBar(t *testing.T) {
+	ui := newTestUI()
+	ui.SetViews([]config.View{{Name: "apf"}})
+	ui.alerts = []alerts.Alert{{Name: "APF queueing", Series: 2, Since: 3}}
+	ui.updateViewsBar()
+	if lines := render(ui, 240, 20); !contains(lines, "ALERT APF queueing: 2 series") {
+		t.Errorf("expected the firing alert in the views bar:\n%s", strings.Join(lines, "\n"))
+	}
+	ui.alerts = nil
+	ui.updateViewsBar()
+	if lines := render(ui, 240, 20); contains(lines, "ALERT") {
+		t.Errorf("expected no alert:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestCharts(t *testing.T) {
+	ui := newTestUI()
+	ui.SetViews([]config.View{{Name: "apf", Charts: []config.Chart{
+		{Metric: "apiserver_flowcontrol_current_inqueue_requests", Filter: "priority_level=workload-low"},
+		{Metric: "apiserver_flowcontrol_rejected_requests_total"},
+	}}})
+	scrape := func(generation int, queued, rejected string) {
+		labels := func(level string) []realtimedata.RealTimeDataMetricLabel {
+			return []realtimedata.RealTimeDataMetricLabel{{Label: "priority_level", Value: level}}
+		}
+		ui.updateTable(map[string]interface{}{"uiData": []TableRow{}, "data": realtimedata.RealTimeData{Generation: generation, Metrics: []realtimedata.RealTimeDataMetric{
+			{Name: "apiserver_flowcontrol_current_inqueue_requests", Type: "gauge", Values: []realtimedata.RealTimeDataMetricValue{
+				{Labels: labels("workload-low"), Value: queued, LastSeen: generation},
+				{Labels: labels("catch-all"), Value: "100", LastSeen: generation},
+			}},
+			{Name: "apiserver_flowcontrol_rejected_requests_total", Type: "counter", Values: []realtimedata.RealTimeDataMetricValue{
+				{Labels: labels("workload-low"), Value: rejected, LastSeen: generation},
+				{Labels: labels("catch-all"), Value: rejected, LastSeen: generation},
+			}},
+		}}})
+	}
+	scrape(1, "4", "1")
+	scrape(1, "4", "1") // the timer and the filter update the table without a new scrape
+	scrape(2, "12", "3")
+	queued := ui.chartSeries["apiserver_flowcontrol_current_inqueue_requests{priority_level=workload-low}"]
+	if queued == nil || len(queued.points) != 2 || queued.points[0].Value != 4 || queued.points[1].Value != 12 || queued.counter {
+		t.Fatalf("expected the workload-low queue of both scrapes, got %+v", queued)
+	}
+	rejected := ui.chartSeries["apiserver_flowcontrol_rejected_requests_total{}"]
+	if rejected == nil || len(rejected.points) != 2 || rejected.points[1].Value != 6 || !rejected.counter {
+		t.Fatalf("expected the sum of the rejected requests, got %+v", rejected)
+	}
+
+	start := time.Unix(1700000000, 0)
+	rejected.points = []chartPoint{{start, 10}, {start.Add(10 * time.Second), 30}, {start.Add(20 * time.Second), 5}}
+	if rates, unit := rejected.values(); len(rates) != 2 || rates[0].Value != 2 || !math.IsNaN(rates[1].Value) || unit != "/s" {
+		t.Errorf("expected a rate and a reset, got %+v %s", rates, unit)
+	}
+
+	if lines := render(ui, 240, 40); contains(lines, "apiserver_flowcontrol_rejected_requests_total") {
+		t.Errorf("expected no charts in the All view:\n%s", strings.Join(lines, "\n"))
+	}
+	ui.selectView(1)
+	lines := render(ui, 240, 40)
+	for _, text := range []string{"apiserver_flowcontrol_current_inqueue_requests priority_level=workload-low 12", "apiserver_flowcontrol_rejected_requests_total -/s", "█", "─"} {
+		if !contains(lines, text) {
+			t.Errorf("expected %q on the screen:\n%s", text, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestChartEventMarkers(t *testing.T) {
+	ui := newTestUI()
+	ui.SetEventSource(func(func([]events.Event)) error { return nil })
+	ui.SetViews([]config.View{{Name: "apf", Charts: []config.Chart{{Metric: "apiserver_flowcontrol_current_inqueue_requests"}}}})
+	start := time.Unix(1700000000, 0)
+	series := &chartSeries{}
+	for i := 0; i < 5; i++ {
+		series.points = append(series.points, chartPoint{Time: start.Add(time.Duration(i) * 10 * time.Second), Value: float64(i)})
+	}
+	ui.chartSeries["apiserver_flowcontrol_current_inqueue_requests{}"] = series
+	ui.selectView(1)
+
+	axis := func() string {
+		for _, line := range render(ui, 120, 40) {
+			if strings.HasPrefix(line, "│") && strings.Contains(line, "─") {
+				return line
+			}
+		}
+		return ""
+	}
+	if line := axis(); strings.Contains(line, "!") {
+		t.Errorf("expected no markers without events: %s", line)
+	}
+	ui.addEvents([]events.Event{{ID: "a", Time: start.Add(25 * time.Second), Type: "Warning", Reason: "BackOff", Object: "Pod/web-0"}})
+	line := axis()
+	x := strings.Index(line, "!")
+	if x < 0 || strings.Count(line, "!") != 1 {
+		t.Fatalf("expected one marker: %s", line)
+	}
+	if prefix := []rune(line[:x]); string(prefix[len(prefix)-3:]) != start.Local().Format("15:04:05")[:3] {
+		t.Errorf("expected the marker under the fourth scrape, after the first 3 characters of the start time: %s", line)
+	}
+}
@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
+	"github.com/rivo/tview"
+)
+
+// Set the function which discovers the annotated pods and services
+func (ui *UI) SetTargetSource(source func() ([]discovery.Target, error)) {
+	ui.targetSource = source
+}
+
+// Set the function which switches the scraper to another target
+func (ui *UI) SetTargetHandler(handler func(target discovery.Target)) {
+	ui.targetHandler = handler
+}
+
+func (ui *UI) openTargetPicker() {
+	if ui.targetHandler == nil {
+		ui.showMessage("targets can only be picked in a cluster")
+		return
+	}
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(" Targets ")
+	list.SetDoneFunc(func() { ui.closeModal("targets") })
+
+	addTargets := func(targets []discovery.Target) {
+		for _, target := range targets {
+			text := tview.Escape(target.String())
+			if target == ui.target {
+				text = "[yellow]" + text
+			}
+			list.AddItem(text, "", 0, func() {
+				ui.closeModal("targets")
+				ui.selectTarget(target)
+			})
+		}
+	}
+	addTargets([]discovery.Target{discovery.APIServer})
+
+	if ui.targetSource != nil {
+		list.AddItem("[gray]discovering...", "", 0, nil)
+		source := ui.targetSource
+		go func() {
+			targets, err := source()
+			ui.app.QueueUpdateDraw(func() {
+				list.RemoveItem(1)
+				if err != nil {
+					list.AddItem(fmt.Sprintf("[red]%s", tview.Escape(err.Error())), "", 0, nil)
+					return
+				}
+				if len(targets) == 0 {
+					list.AddItem("[gray]no annotated pods or services found", "", 0, nil)
+				}
+				addTargets(targets)
+			})
+		}()
+	}
+
+	ui.pages.AddPage("targets", modal(list, 80, 20), true, true)
+	ui.app.SetFocus(list)
+}
+
+func (ui *UI) closeModal(name string) {
+	ui.pages.RemovePage(name)
+	ui.app.SetFocus(ui.bodyPrimitive())
+}
+
+// Switch the scraper in the background, the view is applied again when the first data of the target is there
+func (ui *UI) selectTarget(target discovery.Target) {
+	if target == ui.target || ui.targetHandler == nil {
+		return
+	}
+	ui.target = target
+	ui.rows = nil
+	ui.renderTable()
+	ui.updateFilterFlex()
+	handler := ui.targetHandler
+	go func() {
+		handler(target)
+		ui.app.QueueUpdateDraw(func() {
+			ui.applyView(ui.saveViewState())
+		})
+		ui.ShowMessage(fmt.Sprintf("scraping %s", target))
+	}()
+}
+
+// Center a primitive of a fixed size
+func modal(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
+
+// A modal like the target picker handles its keys itself
+func (ui *UI) modalOpen() bool {
+	name, _ := ui.pages.GetFrontPage()
+	return name != "main"
+}
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+func newTreeView(ui *UI) *tview.TreeView {
+	tree := tview.NewTreeView()
+	tree.SetRoot(tview.NewTreeNode(""))
+	tree.SetTopLevel(1)
+	tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		family, ok := node.GetReference().(string)
+		if !ok {
+			return
+		}
+		if len(node.GetChildren()) == 0 { // a series
+			if row, ok := ui.selectedRow(); ok {
+				ui.openHistory(row)
+			}
+			return
+		}
+		node.SetExpanded(!node.IsExpanded())
+		ui.treeExpanded[family] = node.IsExpanded()
+	})
+	return tree
+}
+
+// Rebuild the tree from the current rows, restoring the expanded families and the selected node
+func (ui *UI) renderTree() {
+	selected := ""
+	if node := ui.tree.GetCurrentNode(); node != nil {
+		selected, _ = node.GetReference().(string)
+	}
+
+	root := ui.tree.GetRoot()
+	root.ClearChildren()
+
+	var family *tview.TreeNode
+	var currentMetric, currentType string
+	var count int
+	var sum float64
+	var selectedNode *tview.TreeNode
+
+	closeFamily := func() {
+		if family != nil {
+			family.SetText(fmt.Sprintf("%s [gray](%s)[white] %d series, sum %s",
+				currentMetric, currentType, count, formatValue(strconv.FormatFloat(sum, 'f', -1, 64))))
+		}
+	}
+
+	for _, row := range ui.currentRows() {
+		if row.MetricName != currentMetric {
+			closeFamily()
+			currentMetric, currentType = row.MetricName, row.Type
+			count, sum = 0, 0
+			family = tview.NewTreeNode("").
+				SetReference(row.MetricName).
+				SetColor(tcell.ColorLightBlue).
+				SetExpanded(ui.treeExpanded[row.MetricName])
+			root.AddChild(family)
+			if selected == row.MetricName {
+				selectedNode = family
+			}
+		}
+		count++
+		if v, err := strconv.ParseFloat(row.Value, 64); err == nil {
+			sum += v
+		}
+		labelString := labelsToString(row.Labels)
+		series := tview.NewTreeNode(fmt.Sprintf("%s [white]= %s", labelString, formatRowValue(row))).
+			SetReference(row.ID)
+		family.AddChild(series)
+		if selected == row.ID {
+			selectedNode = series
+		}
+	}
+	closeFamily()
+
+	if selectedNode == nil && len(root.GetChildren()) > 0 {
+		selectedNode = root.GetChildren()[0]
+	}
+	ui.tree.SetCurrentNode(selectedNode)
+}
+
+func (ui *UI) toggleTree() {
+	ui.treeMode = !ui.treeMode
+	if ui.treeMode {
+		ui.body.SwitchToPage("tree")
+	} else {
+		ui.body.SwitchToPage("table")
+	}
+	ui.renderTable()
+	ui.app.SetFocus(ui.bodyPrimitive())
+}
+
+// The primitive which shows the data in the current mode
+func (ui *UI) bodyPrimitive() tview.Primitive {
+	if ui.historyMode {
+		return ui.historyTable
+	}
+	if ui.apfMode {
+		return ui.apfLevels
+	}
+	if ui.treeMode {
+		return ui.tree
+	}
+	return ui.table
+}
@@ -1,27 +1,108 @@
 package ui
 
 import (
+	"github.com/bvankampen/metrics-viewer/internal/alerts"
+	"github.com/bvankampen/metrics-viewer/internal/apf"
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/bvankampen/metrics-viewer/internal/discovery"
+	"github.com/bvankampen/metrics-viewer/internal/events"
+	"github.com/bvankampen/metrics-viewer/internal/history"
+	"github.com/bvankampen/metrics-viewer/internal/realtimedata"
 	"github.com/rivo/tview"
 	"github.com/urfave/cli"
 )
 
 type TableRow struct {
-	MetricName string
-	Type       string
-	Labels     map[string]string // Universal labels as key-value pairs
-	Value      string            // Main value for the row
+	ID            string // unique per series
+	MetricName    string
+	Type          string
+	Labels        map[string]string // Universal labels as key-value pairs
+	Value         string            // Main value for the row
+	PreviousValue string            // Value of the previous scrape, empty if unknown
+	New           bool              // Series appeared in the last scrape
+	Stale         int               // Number of scrapes the series is missing, 0 if it is in the last scrape
 }
 
 type UI struct {
 	app            *tview.Application
 	table          *tview.Table
+	tree           *tview.TreeView
+	body           *tview.Pages
 	pages          *tview.Pages
 	filterFlex     *tview.Flex
 	filterHandler  func(string)
 	filterText     string
+	filterHistory  []string
 	lastUpdateFlex *tview.Flex
+	statusText     *tview.TextView
 	sortHandler    func(column int, ascending bool)
 	sortAsc        bool
 	sortColumn     int
 	ctx            *cli.Context
+	rows           []TableRow
+	columnar       bool
+	columns        []*tableColumn
+	columnCursor   int
+	groupBy        []string
+	drillGroup     *tableGroup
+	showStale      bool
+	treeMode       bool
+	treeExpanded   map[string]bool // expanded metric families in the tree
+	hideNewColumns bool            // columns of the view are fixed, new label keys are hidden
+	views          []config.View   // the first view shows all metrics
+	currentView    int
+	viewStates     map[string]viewState // state of the views by name
+	viewHandler    func(metrics []string)
+	viewsText      *tview.TextView
+	data           realtimedata.RealTimeData // last scrape, unfiltered
+	apfMode        bool
+	apfView        *tview.Flex
+	apfLevels      *tview.Table
+	apfSchemas     *tview.Table
+	apfConfig      *apf.Configuration // nil until it is fetched
+	apfSource      func() (apf.Configuration, error)
+	target         discovery.Target // scraped target
+	sourceName     string           // shown for other sources than the apiserver scraper
+	targetSource   func() ([]discovery.Target, error)
+	targetHandler  func(target discovery.Target)
+	history        history.Store // nil if no history is kept
+	historyMode    bool
+	historyTable   *tview.Table
+	appFlex        *tview.Flex    // main page, the charts and events panes are resized in it
+	events         []events.Event // oldest first
+	eventsTable    *tview.Table
+	eventSource    func(onEvents func([]events.Event)) error
+	showEvents     bool
+	alerts         []alerts.Alert // firing alerts
+	chartsFlex     *tview.Flex    // charts of the current view
+	chartSeries    map[string]*chartSeries
+	chartsScrape   int // generation of the last scrape in the charts
+}
+
+// State of the UI saved when switching to another view
+type viewState struct {
+	filterText     string
+	sortColumn     int
+	sortAsc        bool
+	groupBy        []string
+	columnar       bool
+	columns        []*tableColumn
+	hideNewColumns bool
+	treeMode       bool
+}
+
+type tableGroup struct {
+	MetricName string
+	Type       string
+	Labels     map[string]string // values of the group by labels
+	Count      int
+	Sum        float64
+	Min        float64
+	Max        float64
+}
+
+type tableColumn struct {
+	Key    string
+	Hidden bool
+	Width  int // 0 means auto
 }
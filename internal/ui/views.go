@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bvankampen/metrics-viewer/internal/alerts"
+	"github.com/bvankampen/metrics-viewer/internal/config"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const allViewName = "All"
+
+// Set the configured views before the UI runs
+func (ui *UI) SetViews(views []config.View) {
+	ui.views = append([]config.View{{Name: allViewName}}, views...)
+}
+
+// Replace the views while the UI is running, the current view stays selected if it still exists
+func (ui *UI) UpdateViews(views []config.View) {
+	ui.app.QueueUpdateDraw(func() {
+		current := ui.views[ui.currentView].Name
+		ui.SetViews(views)
+		ui.viewStates = make(map[string]viewState) // apply the (new) presets
+		ui.currentView = 0
+		for i, view := range ui.views {
+			if view.Name == current {
+				ui.currentView = i
+			}
+		}
+		ui.applyView(ui.presetViewState(ui.views[ui.currentView]))
+	})
+}
+
+func (ui *UI) SetViewHandler(handler func(metrics []string)) {
+	ui.viewHandler = handler
+}
+
+func (ui *UI) selectView(index int) {
+	if index < 0 || index >= len(ui.views) || index == ui.currentView {
+		return
+	}
+	ui.viewStates[ui.views[ui.currentView].Name] = ui.saveViewState()
+	ui.currentView = index
+	view := ui.views[index]
+	state, ok := ui.viewStates[view.Name]
+	if !ok {
+		state = ui.presetViewState(view)
+	}
+	ui.applyView(state)
+}
+
+func (ui *UI) presetViewState(view config.View) viewState {
+	state := viewState{
+		filterText: view.Filter,
+		sortColumn: max(view.Sort.ColumnIndex(), 0),
+		sortAsc:    !view.Sort.Descending,
+		groupBy:    view.GroupBy,
+		treeMode:   view.Tree,
+	}
+	if len(view.Columns) > 0 {
+		state.columnar = true
+		state.hideNewColumns = true
+		for _, key := range view.Columns {
+			state.columns = append(state.columns, &tableColumn{Key: key})
+		}
+	}
+	return state
+}
+
+func (ui *UI) saveViewState() viewState {
+	return viewState{
+		filterText:     ui.filterText,
+		sortColumn:     ui.sortColumn,
+		sortAsc:        ui.sortAsc,
+		groupBy:        ui.groupBy,
+		columnar:       ui.columnar,
+		columns:        ui.columns,
+		hideNewColumns: ui.hideNewColumns,
+		treeMode:       ui.treeMode,
+	}
+}
+
+// Restore the state of a view and send its metrics, filter and sort to the pipeline
+func (ui *UI) applyView(state viewState) {
+	ui.filterText = state.filterText
+	ui.sortColumn = state.sortColumn
+	ui.sortAsc = state.sortAsc
+	ui.groupBy = state.groupBy
+	ui.drillGroup = nil
+	ui.columnar = state.columnar
+	ui.columns = state.columns
+	ui.columnCursor = 0
+	ui.hideNewColumns = state.hideNewColumns
+	if ui.treeMode != state.treeMode {
+		ui.toggleTree()
+	}
+
+	if ui.viewHandler != nil {
+		ui.viewHandler(ui.views[ui.currentView].Metrics)
+	}
+	if ui.filterHandler != nil {
+		ui.filterHandler(ui.filterText)
+	}
+	if ui.sortHandler != nil {
+		ui.sortHandler(ui.sortColumn, ui.sortAsc)
+	}
+	ui.renderTable()
+	ui.renderCharts()
+	ui.updateFilterFlex()
+	ui.updateViewsBar()
+}
+
+// Show the firing alerts next to the views, can be called from other goroutines
+func (ui *UI) SetAlerts(firing []alerts.Alert) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.alerts = firing
+		ui.updateViewsBar()
+	})
+}
+
+func (ui *UI) updateViewsBar() {
+	var builder strings.Builder
+	for i, view := range ui.views {
+		key := "" // only the first 9 views have a number key
+		if i < 9 {
+			key = fmt.Sprint(i + 1)
+		}
+		if i == ui.currentView {
+			builder.WriteString(fmt.Sprintf("[black:yellow] %s %s [-:-] ", key, tview.Escape(view.Name)))
+		} else {
+			builder.WriteString(fmt.Sprintf("[yellow]%s[white] %s  ", key, tview.Escape(view.Name)))
+		}
+	}
+	for _, alert := range ui.alerts {
+		builder.WriteString(fmt.Sprintf(" [white:red] ALERT %s: %d series [-:-]", tview.Escape(alert.Name), alert.Series))
+	}
+	ui.viewsText.SetText(builder.String())
+}
+
+// Handle Tab, Shift-Tab and 1-9 to switch views, returns true if the key was used
+func (ui *UI) handleViewKeyEvents(event *tcell.EventKey) bool {
+	switch key := event.Key(); {
+	case key == tcell.KeyTab:
+		ui.selectView((ui.currentView + 1) % len(ui.views))
+	case key == tcell.KeyBacktab:
+		ui.selectView((ui.currentView + len(ui.views) - 1) % len(ui.views))
+	case key == tcell.KeyRune && event.Rune() >= '1' && event.Rune() <= '9':
+		ui.selectView(int(event.Rune() - '1'))
+	default:
+		return false
+	}
+	return true
+}